@@ -2,24 +2,48 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
+	"io"
 	"io/ioutil"
 	"net/http"
 )
 
+// the speaking styles of the answer, chosen by whether alpha found one
+var (
+	answerStyle = EnvString("ALEXA_ANSWER_STYLE", "friendly")
+	errorStyle  = EnvString("ALEXA_ERROR_STYLE", "empathetic")
+)
+
 func ProcessAlexa(w http.ResponseWriter, r *http.Request) {
-	sttRespBody, err, errCode := SpeechToTextManager(r)
+	alexaReqBody, format, err, errCode := AlexaRequest(r)
 	if err != nil {
 		AlexaErrResponse(w, err, errCode) // return an error response from the microservice
+		return
 	}
 
+	sttRespBody, err, errCode := SpeechToTextManager(alexaReqBody)
+	if err != nil {
+		AlexaErrResponse(w, err, errCode) // return an error response from the microservice
+		return
+	}
+
+	question, language := SpeechQuestion(sttRespBody) // the answer is spoken in the language of the question
+
 	alphaRespBody, err, errCode := AlphaManager(sttRespBody)
 	if err != nil {
 		AlexaErrResponse(w, err, errCode) // return an error response from the microservice
+		return
+	}
+
+	ttsReqBody, err, errCode := SpeechRequest(alphaRespBody, format, question, language)
+	if err != nil {
+		AlexaErrResponse(w, err, errCode) // return an error response from the microservice
+		return
 	}
 
-	ttsRespBody, err, errCode := TextToSpeechManager(alphaRespBody)
+	ttsRespBody, err, errCode := TextToSpeechManager(ttsReqBody)
 	if err != nil {
 		AlexaErrResponse(w, err, errCode) // return an error response from the microservice
 	} else {
@@ -27,10 +51,32 @@ func ProcessAlexa(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func SpeechToTextManager(r *http.Request) ([]byte, error, int) {
+// AlexaRequest reads the request body, which is passed on to the stt microservice, and the optional
+// output format of the spoken answer.
+func AlexaRequest(r *http.Request) ([]byte, string, error, int) {
+	alexaReqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", err, http.StatusBadRequest
+	}
+
+	t := map[string]interface{}{}
+	err = json.Unmarshal(alexaReqBody, &t)
+	if err != nil {
+		return nil, "", err, http.StatusBadRequest // could not decode json query due to perceived client error
+	}
+
+	format, ok := t["format"].(string)
+	if _, present := t["format"]; present && !ok {
+		return nil, "", errors.New("Field 'format' must be a string"), http.StatusBadRequest
+	}
+
+	return alexaReqBody, format, nil, 0 // the tts microservice checks the format, or uses its default
+}
+
+func SpeechToTextManager(alexaReqBody []byte) ([]byte, error, int) {
 	sttUri := "http://localhost:3002/stt"
 
-	sttReq, err := http.NewRequest("POST", sttUri, r.Body)
+	sttReq, err := http.NewRequest("POST", sttUri, bytes.NewReader(alexaReqBody))
 	if err != nil {
 		return nil, err, http.StatusBadRequest // the request was malformed
 	}
@@ -95,10 +141,125 @@ func AlphaManager(sttRespBody []byte) ([]byte, error, int) {
 	return alphaRespBody, nil, 0
 }
 
-func TextToSpeechManager(alphaRespBody []byte) ([]byte, error, int) {
+// SpeechRequest adds the speaking style, voice and output format to the answer from alpha. The style
+// depends on whether alpha found an answer, so "I don't know" is not read out like good news, and the
+// voice on the language of the question, which the answer is translated into. The persona for that
+// language then phrases the answer.
+func SpeechRequest(alphaRespBody []byte, format string, question string, language string) ([]byte, error, int) {
+	t := map[string]interface{}{}
+	err := json.Unmarshal(alphaRespBody, &t)
+	if err != nil {
+		return nil, err, http.StatusInternalServerError // could not decode the alpha response
+	}
+
+	answered := t["source"] != "none" // some source could answer the question
+	text, _ := t["text"].(string)
+	text, locale := AnswerLanguage(text, language)
+
+	localePersona := PersonaFor(locale)
+	if localePersona != nil {
+		text = localePersona.Phrase(text, question, answered)
+	}
+	t["text"] = text
+	SetVoice(t, locale, localePersona, answered)
+	if format != "" {
+		t["format"] = format
+	}
+
+	ttsReqBody, err := json.Marshal(t)
+	if err != nil {
+		return nil, err, http.StatusInternalServerError
+	}
+
+	return ttsReqBody, nil, 0
+}
+
+// SetVoice chooses the voice and style of a tts request, preferring the persona's over the configured ones.
+func SetVoice(t map[string]interface{}, locale string, localePersona *persona, answered bool) {
+	voice, style := VoiceForLocale(locale), answerStyle
+	if !answered {
+		style = errorStyle
+	}
+	if localePersona != nil {
+		if localePersona.Voice != "" {
+			voice = localePersona.Voice
+		}
+		if answered && localePersona.Style != "" {
+			style = localePersona.Style
+		}
+		if !answered && localePersona.ErrorStyle != "" {
+			style = localePersona.ErrorStyle
+		}
+	}
+
+	if voice != "" {
+		t["voice"] = voice
+	} else {
+		t["locale"] = locale // tts picks a voice from its catalog
+	}
+	if style != "" {
+		t["style"] = style
+	}
+}
+
+// ProcessGreeting speaks the persona's greeting, in the language of an optional
+// {"language": "de-DE"} and output format of an optional {"format": ...}
+func ProcessGreeting(w http.ResponseWriter, r *http.Request) {
+	ttsReqBody, err, errCode := GreetingRequest(r)
+	if err != nil {
+		AlexaErrResponse(w, err, errCode) // return an error response from the microservice
+		return
+	}
+
+	ttsRespBody, err, errCode := TextToSpeechManager(ttsReqBody)
+	if err != nil {
+		AlexaErrResponse(w, err, errCode) // return an error response from the microservice
+	} else {
+		AlexaResponse(w, ttsRespBody) // success
+	}
+}
+
+func GreetingRequest(r *http.Request) ([]byte, error, int) {
+	t := map[string]interface{}{}
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil && err != io.EOF { // an empty body greets in the default language
+		return nil, err, http.StatusBadRequest // could not decode json query due to perceived client error
+	}
+
+	fields := map[string]string{"language": answerLanguage, "format": ""}
+	for name := range fields {
+		if value, present := t[name]; present {
+			var ok bool
+			if fields[name], ok = value.(string); !ok {
+				return nil, errors.New("Field '" + name + "' must be a string"), http.StatusBadRequest
+			}
+		}
+	}
+
+	locale := fields["language"]
+	localePersona := PersonaFor(locale)
+	if localePersona == nil || localePersona.Greeting == "" {
+		return nil, errors.New("No greeting is configured for the language '" + locale + "'"), http.StatusNotFound
+	}
+
+	ttsReq := map[string]interface{}{"text": localePersona.Greeting}
+	SetVoice(ttsReq, locale, localePersona, true)
+	if fields["format"] != "" {
+		ttsReq["format"] = fields["format"]
+	}
+
+	ttsReqBody, err := json.Marshal(ttsReq)
+	if err != nil {
+		return nil, err, http.StatusInternalServerError
+	}
+
+	return ttsReqBody, nil, 0
+}
+
+func TextToSpeechManager(ttsReqBody []byte) ([]byte, error, int) {
 	ttsUri := "http://localhost:3003/tts"
 
-	ttsReq, err := http.NewRequest("POST", ttsUri, bytes.NewReader(alphaRespBody))
+	ttsReq, err := http.NewRequest("POST", ttsUri, bytes.NewReader(ttsReqBody))
 	if err != nil {
 		return nil, err, http.StatusBadRequest // the request was malformed
 	}
@@ -148,12 +309,17 @@ func AlexaHandler() {
 	r := mux.NewRouter()
 	// document
 	r.HandleFunc("/alexa", ProcessAlexa).Methods("POST")
+	r.HandleFunc("/alexa/greeting", ProcessGreeting).Methods("POST")
 	http.ListenAndServe(":3000", r)
 	//	3001 / alpha
 	//	3002 / stt
 	//	3003 / tts
 }
 
+// go run alexa.go alexalocale.go alexapersona.go alexatranslate.go config.go secrets.go
 func main() {
+	localeVoices = MustParseLocaleVoices(voicesSetting)
+	translator = NewTranslator(EnvString("ALEXA_TRANSLATOR", "none"))
+	personas = MustLoadPersonas(personaFile)
 	AlexaHandler()
 }
@@ -0,0 +1,31 @@
+#!/bin/sh
+# Checks answers are spoken in the language of the question, start the stand-in and every microservice
+# first, with the stand-in's translator:
+#   go run azurestub.go
+#   export SPEECH_KEY=stub SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken
+#   STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 go run stt.go ...
+#   TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 go run tts.go ...
+#   go run alpha.go ...
+#   ALEXA_TRANSLATOR=azure TRANSLATOR_KEY=stub ALEXA_TRANSLATOR_ENDPOINT=http://localhost:3010/translate go run alexa.go ...
+FAILED=0
+SPEECH=`base64 -i speech.wav | tr -d "\n"`
+
+check() { # check <description> <json request> <expected voice> <expected text in the ssml> [<text that must not appear>]
+	echo "$2" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3000/alexa`
+	curl -s localhost:3010/stub/ssml > ssml
+	if [ "$STATUS" = "200" ] && grep -q "name=\"$3\"" ssml && grep -q -- "$4" ssml && { [ -z "$5" ] || ! grep -q -- "$5" ssml; }; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output` `cat ssml`"
+		FAILED=1
+	fi
+}
+
+check "default language" "{\"speech\":\"$SPEECH\"}" en-US-JennyNeural 'xml:lang="en-US"' '\[de\]'
+check "british english isn't translated" "{\"speech\":\"$SPEECH\",\"language\":\"en-GB\"}" en-GB-SoniaNeural 'xml:lang="en-GB"' '\[en\]'
+check "german is translated" "{\"speech\":\"$SPEECH\",\"language\":\"de-DE\"}" de-DE-KatjaNeural '\[de\] '
+check "welsh is translated" "{\"speech\":\"$SPEECH\",\"language\":\"cy-GB\"}" cy-GB-NiaNeural '\[cy\] '
+
+rm -f input output ssml
+exit $FAILED
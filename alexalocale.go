@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// Answers are spoken in the language the question was asked in, which stt recognised or the caller
+// requested, with the voice ALEXA_VOICES maps that locale to, e.g. de-DE=de-DE-KatjaNeural. A locale
+// without a voice of its own uses the first one for the same language, or else is left to tts to pick.
+
+var (
+	answerLanguage = EnvString("ALEXA_ANSWER_LANGUAGE", "en-US") // the language alpha answers in
+	voicesSetting  = EnvList("ALEXA_VOICES", []string{"en-US=en-US-JennyNeural", "en-GB=en-GB-SoniaNeural",
+		"de-DE=de-DE-KatjaNeural", "cy-GB=cy-GB-NiaNeural"})
+)
+
+type localeVoice struct {
+	Locale string
+	Voice  string
+}
+
+var localeVoices []localeVoice // loaded by main, in the order they are configured
+
+func MustParseLocaleVoices(setting []string) []localeVoice {
+	voices := []localeVoice{}
+	for _, item := range setting {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			println("Invalid ALEXA_VOICES entry '" + item + "' - Write it as locale=voice, e.g. de-DE=de-DE-KatjaNeural")
+			os.Exit(1)
+		}
+		voices = append(voices, localeVoice{Locale: strings.TrimSpace(parts[0]), Voice: strings.TrimSpace(parts[1])})
+	}
+	return voices
+}
+
+// VoiceForLocale is the configured voice for the locale, or one for the same language.
+func VoiceForLocale(locale string) string {
+	for _, voice := range localeVoices {
+		if strings.EqualFold(voice.Locale, locale) {
+			return voice.Voice
+		}
+	}
+	for _, voice := range localeVoices {
+		if LocaleLanguage(voice.Locale) == LocaleLanguage(locale) {
+			return voice.Voice
+		}
+	}
+	return ""
+}
+
+// LocaleLanguage is the language of a locale, e.g. de for de-DE
+func LocaleLanguage(locale string) string {
+	return strings.ToLower(strings.SplitN(locale, "-", 2)[0])
+}
+
+// AnswerLanguage translates the answer into the asker's language when it is in another one, and
+// returns the locale it should be spoken in. Without a translator, or if translation fails, the
+// answer is spoken as it is in alpha's language.
+func AnswerLanguage(text, locale string) (string, string) {
+	if locale == "" {
+		return text, answerLanguage
+	}
+	if LocaleLanguage(locale) == LocaleLanguage(answerLanguage) {
+		return text, locale // e.g. answered in en-US, spoken in en-GB
+	}
+	if translator == nil {
+		println("No translator for " + locale + ", answering in " + answerLanguage)
+		return text, answerLanguage
+	}
+
+	translated, err, _ := translator.Translate(text, LocaleLanguage(answerLanguage), LocaleLanguage(locale))
+	if err != nil {
+		println("Could not translate the answer into " + locale + ", answering in " + answerLanguage + " - " + err.Error())
+		return text, answerLanguage
+	}
+
+	println("Translated: '" + text + "' -> '" + translated + "'")
+	return translated, locale
+}
+
+// SpeechQuestion reads the question stt recognised and the locale it was recognised in, empty if it
+// gave none.
+func SpeechQuestion(sttRespBody []byte) (string, string) {
+	t := map[string]interface{}{}
+	json.Unmarshal(sttRespBody, &t) // a malformed response is reported by alpha
+	question, _ := t["text"].(string)
+	language, _ := t["language"].(string)
+	return question, language
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The persona file named by ALEXA_PERSONA gives the assistant its voice, style and phrasing for each
+// locale or language, e.g.
+//
+//	{"en": {"voice": "en-GB-RyanNeural", "style": "cheerful", "errorStyle": "sad",
+//	        "greeting": "Hello, I'm Ryan.", "error": "I'm afraid I couldn't find that out.",
+//	        "templates": [
+//	            {"question": "(?i)how far is it from (?P<from>.+) to (?P<to>[^?]+)", "answer": "The distance from {from} to {to} is {answer}"},
+//	            {"answer": "Here's what I found: {answer}"}]}}
+//
+// The first template whose question pattern matches the question frames the answer, filling in
+// {answer}, {question} and the named groups of the pattern. Templates are plain text rather than ssml,
+// and the filled in phrasing is sent to tts as text, which escapes it, so neither the configuration nor
+// the words of a question can add markup.
+
+var personaFile = EnvString("ALEXA_PERSONA", "") // answers are spoken as alpha gives them when unset
+
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+type personaTemplate struct {
+	Question string `json:"question"` // pattern with named groups, matched against the question, empty to match any
+	Answer   string `json:"answer"`
+
+	pattern *regexp.Regexp
+}
+
+type persona struct {
+	Voice      string            `json:"voice"`
+	Style      string            `json:"style"`
+	ErrorStyle string            `json:"errorStyle"`
+	Greeting   string            `json:"greeting"`
+	Error      string            `json:"error"` // said in place of alpha's own message when no answer was found
+	Templates  []personaTemplate `json:"templates"`
+}
+
+var personas map[string]*persona // loaded by main, keyed by locale or language, nil without a persona file
+
+func MustLoadPersonas(path string) map[string]*persona {
+	if path == "" {
+		return nil
+	}
+
+	personas, err := LoadPersonas(path)
+	if err != nil {
+		println("Could not load the persona from " + path + " - " + err.Error())
+		os.Exit(1)
+	}
+	println("Loaded the persona for " + strconv.Itoa(len(personas)) + " locales from " + path)
+	return personas
+}
+
+func LoadPersonas(path string) (map[string]*persona, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	personas := map[string]*persona{}
+	if err = json.Unmarshal(contents, &personas); err != nil {
+		return nil, err
+	}
+
+	for locale, localePersona := range personas {
+		if localePersona == nil {
+			return nil, errors.New(locale + " has no persona")
+		}
+		phrasings := []string{localePersona.Greeting, localePersona.Error}
+		for i := range localePersona.Templates {
+			template := &localePersona.Templates[i]
+			where := locale + " template " + strconv.Itoa(i+1)
+			if template.pattern, err = regexp.Compile(template.Question); err != nil {
+				return nil, errors.New(where + " has an invalid question pattern - " + err.Error())
+			}
+			if strings.TrimSpace(template.Answer) == "" {
+				return nil, errors.New(where + " has no answer phrasing")
+			}
+
+			names := append([]string{"answer", "question"}, template.pattern.SubexpNames()...)
+			for _, placeholder := range placeholderPattern.FindAllStringSubmatch(template.Answer, -1) {
+				if !Contains(names, placeholder[1]) {
+					return nil, errors.New(where + " uses {" + placeholder[1] + "} - Use {answer}, {question} or a named group of its question pattern")
+				}
+			}
+			phrasings = append(phrasings, template.Answer)
+		}
+		for _, phrasing := range phrasings {
+			if strings.ContainsAny(phrasing, "<>") {
+				return nil, errors.New(locale + " phrasing '" + phrasing + "' looks like markup - Phrasings are plain text")
+			}
+		}
+	}
+	return personas, nil
+}
+
+// PersonaFor is the persona of the locale, or of its language, nil if there is none.
+func PersonaFor(locale string) *persona {
+	if localePersona, ok := personas[locale]; ok {
+		return localePersona
+	}
+	return personas[LocaleLanguage(locale)]
+}
+
+// Phrase frames an answer with the first template matching the question, or replaces the message
+// for a question alpha could not answer.
+func (localePersona *persona) Phrase(answer, question string, answered bool) string {
+	if !answered {
+		if localePersona.Error != "" {
+			return localePersona.Error
+		}
+		return answer
+	}
+
+	for _, template := range localePersona.Templates {
+		match := template.pattern.FindStringSubmatch(question)
+		if match == nil {
+			continue
+		}
+
+		values := map[string]string{"answer": answer, "question": question}
+		for i, name := range template.pattern.SubexpNames() {
+			if name != "" {
+				values[name] = strings.TrimSpace(match[i])
+			}
+		}
+		// filled in a single pass, so a question containing {answer} is read as it is
+		return placeholderPattern.ReplaceAllStringFunc(template.Answer, func(placeholder string) string {
+			return values[placeholder[1:len(placeholder)-1]]
+		})
+	}
+	return answer
+}
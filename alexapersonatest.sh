@@ -0,0 +1,44 @@
+#!/bin/sh
+# Checks the persona phrases answers and greetings, start the stand-in and every microservice first,
+# with the test knowledge base, persona and the stand-in's translator:
+#   go run azurestub.go
+#   export SPEECH_KEY=stub SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken
+#   STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 go run stt.go ...
+#   TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 go run tts.go ...
+#   mkdir kb && cp alexapersonatest.qa kb && ALPHA_BACKEND=kb ALPHA_KB_DIR=kb go run alpha.go ...
+#   ALEXA_PERSONA=alexapersonatest.json ALEXA_TRANSLATOR=azure TRANSLATOR_KEY=stub \
+#   ALEXA_TRANSLATOR_ENDPOINT=http://localhost:3010/translate go run alexa.go ...
+FAILED=0
+SPEECH=`base64 -i speech.wav | tr -d "\n"`
+
+check() { # check <description> <url> <json request> <expected status> <expected text in the response or ssml>...
+	echo "$3" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input $2`
+	curl -s localhost:3010/stub/ssml >> output
+	RESULT=PASS
+	[ "$STATUS" = "$4" ] || RESULT=FAIL
+	DESCRIPTION=$1; shift 4
+	for expected in "$@"; do
+		grep -q -- "$expected" output || RESULT=FAIL
+	done
+	if [ $RESULT = PASS ]; then
+		echo "PASS $DESCRIPTION"
+	else
+		echo "FAIL $DESCRIPTION - got $STATUS `tail -c 400 output`"
+		FAILED=1
+	fi
+}
+
+check "template with named groups" localhost:3000/alexa "{\"speech\":\"$SPEECH\"}" 200 \
+	'name="en-GB-RyanNeural"' 'style="cheerful"' '>silver melts at 961.8 degrees Celsius.<'
+check "template of the translated language" localhost:3000/alexa "{\"speech\":\"$SPEECH\",\"language\":\"de-DE\"}" 200 \
+	'name="de-DE-KatjaNeural"' 'Ich habe Folgendes gefunden: \[de\] 961.8 degrees Celsius.'
+check "greeting" localhost:3000/alexa/greeting '' 200 '"mimeType":"audio/wav"' \
+	'name="en-GB-RyanNeural"' 'Hello, I&#39;m Ryan. Ask me anything.'
+check "greeting in german" localhost:3000/alexa/greeting '{"language":"de-DE"}' 200 'name="de-DE-KatjaNeural"' 'Hallo, frag mich etwas.'
+check "greeting format" localhost:3000/alexa/greeting '{"format":"audio-16khz-32kbitrate-mono-mp3"}' 200 '"mimeType":"audio/mpeg"'
+check "no greeting for the language" localhost:3000/alexa/greeting '{"language":"fr-FR"}' 404 "No greeting is configured for the language 'fr-FR'"
+check "language must be a string" localhost:3000/alexa/greeting '{"language":7}' 400 "Field 'language' must be a string"
+
+rm -f input output
+exit $FAILED
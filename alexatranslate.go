@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Alpha's sources answer in english, so a question asked in another language is answered in english
+// unless a translator is configured with ALEXA_TRANSLATOR. The azure backend uses microsoft
+// translator, and ALEXA_TRANSLATOR_ENDPOINT=http://localhost:3010/translate points it at azurestub.go,
+// which marks its translations with the target language, e.g. [de] The answer.
+
+const TRANSLATOR_URI = "https://api.cognitive.microsofttranslator.com/translate"
+
+var (
+	translatorEndpoint = EnvString("ALEXA_TRANSLATOR_ENDPOINT", TRANSLATOR_URI)
+	translatorRegion   = EnvString("TRANSLATOR_REGION", EnvString("SPEECH_REGION", "uksouth"))
+	translatorTimeout  = EnvDuration("ALEXA_TRANSLATOR_TIMEOUT", 10*time.Second)
+)
+
+// Translator translates an answer between languages, given as language codes such as en or de.
+type Translator interface {
+	Translate(text, from, to string) (string, error, int)
+}
+
+var translator Translator // chosen by main, nil when answers are not translated
+
+var translatorKey *Secret // loaded by NewTranslator for the azure backend
+
+// NewTranslator picks the backend named by ALEXA_TRANSLATOR, exiting if it can't be set up.
+func NewTranslator(backend string) Translator {
+	switch backend {
+	case "none":
+		return nil
+	case "azure":
+		translatorKey = MustLoadSecret("TRANSLATOR_KEY") // fail fast rather than on the first question
+		return azureTranslator{}
+	}
+
+	println("Unknown ALEXA_TRANSLATOR '" + backend + "' - Choose none or azure")
+	os.Exit(1)
+	return nil
+}
+
+// azureTranslator uses the microsoft translator rest api.
+type azureTranslator struct{}
+
+func (azureTranslator) Translate(text, from, to string) (string, error, int) {
+	body, err := json.Marshal([]map[string]string{{"Text": text}})
+	if err != nil {
+		return "", err, http.StatusInternalServerError
+	}
+
+	query := url.Values{}
+	query.Set("api-version", "3.0")
+	query.Set("from", from)
+	query.Set("to", to)
+	translateReq, err := http.NewRequest("POST", translatorEndpoint+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return "", err, http.StatusBadRequest // the request was malformed
+	}
+
+	translateReq.Header.Set("Content-Type", "application/json")
+	translateReq.Header.Set("Ocp-Apim-Subscription-Key", translatorKey.Value())
+	translateReq.Header.Set("Ocp-Apim-Subscription-Region", translatorRegion)
+
+	client := &http.Client{Timeout: translatorTimeout}
+	translateResp, err := client.Do(translateReq)
+	if err != nil {
+		return "", errors.New(RedactSecrets(err.Error())), http.StatusNotFound // microsoft translator could not be reached
+	}
+	defer translateResp.Body.Close()
+
+	if translateResp.StatusCode != http.StatusOK {
+		return "", errors.New("Microsoft translator returned " + strconv.Itoa(translateResp.StatusCode)), translateResp.StatusCode
+	}
+
+	translateRespBody, err := ioutil.ReadAll(translateResp.Body)
+	if err != nil {
+		return "", err, http.StatusInternalServerError
+	}
+
+	translations := []struct {
+		Translations []struct {
+			Text string
+		}
+	}{}
+	err = json.Unmarshal(translateRespBody, &translations)
+	if err != nil || len(translations) == 0 || len(translations[0].Translations) == 0 {
+		return "", errors.New("Microsoft translator returned no translation"), http.StatusBadGateway
+	}
+
+	return translations[0].Translations[0].Text, nil, 0
+}
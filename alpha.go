@@ -7,33 +7,40 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
-const (
-	URI = "http://api.wolframalpha.com/v1/result"
-	KEY = ""
+const URI = "http://api.wolframalpha.com/v1/result"
+
+// ALPHA_ENDPOINT overrides URI, e.g. http://localhost:3010/v1/result for azurestub.go, and the spoken
+// results endpoint, whose full sentence answers are used as a fallback, follows it
+var (
+	alphaEndpoint  = EnvString("ALPHA_ENDPOINT", URI)
+	spokenEndpoint = EnvString("ALPHA_SPOKEN_ENDPOINT", strings.Replace(alphaEndpoint, "/v1/result", "/v1/spoken", 1))
 )
 
+var appID *Secret // loaded by NewAnswerEngine
+
 func ProcessAlpha(w http.ResponseWriter, r *http.Request) {
 	t := map[string]interface{}{}
 	err := json.NewDecoder(r.Body).Decode((&t)) // could not decode json query due to perceived client error
 	if err != nil {
 		AlphaErrResponse(w, err, http.StatusBadRequest) // bad request due to perceived client error
 	} else {
-		textQuery := t["text"].(string)
+		textQuery := NormalizeQuery(t["text"].(string)) // strip wake words and fillers that confuse wolfram alpha
 
-		alphaResp, err, errCode := AlphaService(textQuery)
+		alphaResp, source, err, errCode := AnswerChain(textQuery) // falls back to other sources when there is no answer
 		if err != nil {
 			AlphaErrResponse(w, err, errCode) // return an error response from the microservice
 		} else {
-			AlphaResponse(w, alphaResp) // success
+			AlphaResponse(w, alphaResp, source) // success
 		}
 	}
 }
 
-func AlphaService(textQuery string) ([]byte, error, int) {
-	println(textQuery)                                                     // check the question
-	alphaURI := URI + "?appid=" + KEY + "&i=" + url.QueryEscape(textQuery) // html encoded string
+func AlphaService(uri string, textQuery string) ([]byte, error, int) {
+	println(textQuery)                                                                                // check the question
+	alphaURI := uri + "?appid=" + url.QueryEscape(appID.Value()) + "&i=" + url.QueryEscape(textQuery) // html encoded string
 
 	wolframResp, err := http.Get(alphaURI)
 	if err != nil {
@@ -80,22 +87,26 @@ func CheckAlphaStatusErr(errStatus int) error {
 	return errors.New("The precise error could not be determined by wolfram alpha - Refer to error status code!")
 }
 
-func AlphaResponse(w http.ResponseWriter, alphaResp []byte) {
+func AlphaResponse(w http.ResponseWriter, alphaResp []byte, source string) {
 	w.WriteHeader(http.StatusOK)
-	u := map[string]interface{}{"text": string(alphaResp)}
+	// source names the answer source, or is "none" when nothing had an answer
+	u := map[string]interface{}{"text": string(alphaResp), "source": source}
 	w.Header().Set("Content-Type", "application/json") // return microservice response as json
 	json.NewEncoder(w).Encode(u)                       // encode string text as json object
 }
 
 func AlphaErrResponse(w http.ResponseWriter, err error, errCode int) {
+	message := RedactSecrets(err.Error()) // a failed request reports its url, which contains the appid
 	w.WriteHeader(errCode)
-	w.Write([]byte(err.Error()))
+	w.Write([]byte(message))
 	w.Header().Set("Content-Type", "text") // return error message as text
 	println(errCode)
-	println(err.Error()) // display the error message on the console
+	println(message) // display the error message on the console
 }
 
+// go run alpha.go alphaengine.go alphafallback.go alphakb.go alphaquery.go config.go secrets.go
 func main() {
+	answerSources = NewAnswerSources(EnvString("ALPHA_BACKEND", "wolfram"), EnvList("ALPHA_FALLBACKS", []string{"spoken", "reformulate", "kb"}))
 	r := mux.NewRouter()
 	// document
 	r.HandleFunc("/alpha", ProcessAlpha).Methods("POST")
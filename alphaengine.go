@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+)
+
+// AnswerEngine answers a question with a short text suitable for speaking. An engine without an
+// answer returns http.StatusNotImplemented, as wolfram alpha does.
+type AnswerEngine interface {
+	Answer(textQuery string) ([]byte, error, int)
+}
+
+var kb *knowledgeBase // shared by every source that uses the knowledge base
+
+// NewAnswerEngine sets up the answer source with the given name, exiting if it can't be set up.
+func NewAnswerEngine(name string) AnswerEngine {
+	switch name {
+	case "wolfram":
+		LoadAppID()
+		return wolframEngine{uri: alphaEndpoint}
+	case "spoken":
+		LoadAppID()
+		return wolframEngine{uri: spokenEndpoint}
+	case "reformulate":
+		LoadAppID()
+		return reformulatingEngine{wolframEngine{uri: alphaEndpoint}}
+	case "kb":
+		if kb == nil {
+			kb = MustLoadKnowledgeBase(EnvString("ALPHA_KB_DIR", KB_DIR))
+		}
+		return kb
+	}
+
+	println("Unknown answer source '" + name + "' - Choose wolfram, spoken, reformulate or kb")
+	os.Exit(1)
+	return nil
+}
+
+func LoadAppID() {
+	if appID == nil {
+		appID = MustLoadSecret("WOLFRAM_APPID") // fail fast rather than on the first request
+	}
+}
+
+// wolframEngine uses the wolfram alpha short answers or spoken results api.
+type wolframEngine struct {
+	uri string
+}
+
+func (wolfram wolframEngine) Answer(textQuery string) ([]byte, error, int) {
+	return AlphaService(wolfram.uri, textQuery)
+}
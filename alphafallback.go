@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+var noAnswer = EnvString("ALPHA_NO_ANSWER", "Sorry, I don't know the answer to that.")
+
+type answerSource struct {
+	Name   string
+	Engine AnswerEngine
+}
+
+var answerSources []answerSource // the backend first, then the fallbacks in order, set up by main
+
+func NewAnswerSources(backend string, fallbacks []string) []answerSource {
+	sources := []answerSource{{Name: backend, Engine: NewAnswerEngine(backend)}}
+	for _, name := range fallbacks {
+		if name == "kb" && name != backend && !KnowledgeBaseConfigured() {
+			println("Skipping the kb fallback, there is no knowledge base in " + KB_DIR + " - Set ALPHA_KB_DIR to use one")
+			continue
+		}
+		if name != backend {
+			sources = append(sources, answerSource{Name: name, Engine: NewAnswerEngine(name)})
+		}
+	}
+	return sources
+}
+
+// AnswerChain asks each source in turn until one has an answer, and names the source that answered.
+// When none of them has an answer, or a source can't be reached or fails, a friendly reply is returned
+// rather than an error. Only a misconfigured source, e.g. a bad appid, is reported as an error.
+func AnswerChain(textQuery string) ([]byte, string, error, int) {
+	for _, source := range answerSources {
+		answer, err, errCode := source.Engine.Answer(textQuery)
+		if err == nil {
+			return answer, source.Name, nil, 0
+		}
+		if errCode == http.StatusUnauthorized || errCode == http.StatusForbidden { // a bad appid is reported rather than hidden
+			return nil, source.Name, err, errCode
+		}
+		println(source.Name + " has no answer, " + RedactSecrets(err.Error()))
+	}
+
+	return []byte(noAnswer), "none", nil, 0
+}
+
+// reformulatingEngine retries the question in simpler forms until one of them has an answer.
+type reformulatingEngine struct {
+	engine AnswerEngine
+}
+
+func (reformulating reformulatingEngine) Answer(textQuery string) ([]byte, error, int) {
+	for _, reformulated := range Reformulations(textQuery) {
+		answer, err, errCode := reformulating.engine.Answer(reformulated)
+		if err == nil || errCode != http.StatusNotImplemented {
+			return answer, err, errCode
+		}
+	}
+
+	return nil, errors.New("No reformulation of the question has an answer."), http.StatusNotImplemented
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// The knowledge base is a directory of markdown and Q&A files. Markdown is split into passages at
+// headings and blank lines, and Q&A files hold blocks of "Q: question" followed by "A: answer".
+// Questions are matched against the passages with BM25 and the best passage is trimmed for speech.
+
+const (
+	BM25_K1 = 1.2  // how quickly repeated terms stop adding to the score
+	BM25_B  = 0.75 // how much long passages are penalised
+)
+
+var (
+	kbMinScore = EnvFloat("ALPHA_KB_MIN_SCORE", 1.0) // weaker matches are treated as no answer
+	kbMaxChars = int(EnvFloat("ALPHA_KB_MAX_CHARS", 300))
+
+	kbBlock     = regexp.MustCompile(`\n\s*\n`)
+	kbWord      = regexp.MustCompile(`[\p{L}\p{N}]+`)
+	kbLink      = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	kbMarkup    = regexp.MustCompile("(?m)^\\s*(#+|[-*+]|\\d+\\.|>)\\s+|[*_`~|]")
+	kbSentence  = regexp.MustCompile(`[.!?](\s|$)`)
+	kbStopWords = map[string]bool{
+		"a": true, "an": true, "and": true, "are": true, "at": true, "be": true, "by": true, "do": true,
+		"for": true, "from": true, "how": true, "i": true, "in": true, "is": true, "it": true, "me": true,
+		"of": true, "on": true, "or": true, "our": true, "the": true, "this": true, "to": true, "was": true,
+		"we": true, "what": true, "when": true, "where": true, "which": true, "who": true, "why": true, "with": true,
+	}
+)
+
+type kbPassage struct {
+	Source string         // file the passage came from, for the logs
+	Answer string         // text to speak
+	Terms  map[string]int // term frequencies of the indexed text
+	Length int
+}
+
+type knowledgeBase struct {
+	passages      []kbPassage
+	documentFreq  map[string]int
+	averageLength float64
+}
+
+const KB_DIR = "kb" // used when ALPHA_KB_DIR isn't set
+
+// KnowledgeBaseConfigured reports whether there is a knowledge base to load, either named by ALPHA_KB_DIR
+// or in the default directory. Without one the kb fallback is skipped, so deployments that only use wolfram
+// alpha still start.
+func KnowledgeBaseConfigured() bool {
+	if EnvString("ALPHA_KB_DIR", "") != "" {
+		return true // a missing directory that was asked for is reported when it's loaded
+	}
+	info, err := os.Stat(KB_DIR)
+	return err == nil && info.IsDir()
+}
+
+func MustLoadKnowledgeBase(dir string) *knowledgeBase {
+	kb, err := LoadKnowledgeBase(dir)
+	if err != nil {
+		println("Could not load the knowledge base from " + dir + " - " + err.Error())
+		os.Exit(1)
+	}
+	println("Indexed", len(kb.passages), "passages from "+dir)
+	return kb
+}
+
+func LoadKnowledgeBase(dir string) (*knowledgeBase, error) {
+	kb := &knowledgeBase{documentFreq: map[string]int{}}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".md" && ext != ".markdown" && ext != ".txt" && ext != ".qa" {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if ext == ".qa" || strings.HasPrefix(strings.TrimSpace(string(contents)), "Q:") {
+			kb.addQA(path, string(contents))
+		} else {
+			kb.addMarkdown(path, string(contents))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(kb.passages) == 0 {
+		return nil, errors.New("no passages were found")
+	}
+
+	total := 0
+	for _, passage := range kb.passages {
+		total += passage.Length
+	}
+	kb.averageLength = float64(total) / float64(len(kb.passages))
+
+	return kb, nil
+}
+
+func (kb *knowledgeBase) addQA(source string, contents string) {
+	question, answer := "", []string{}
+	flush := func() {
+		if question != "" && len(answer) > 0 { // the question is indexed along with its answer
+			kb.add(source, question+" "+strings.Join(answer, " "), strings.Join(answer, " "))
+		}
+		question, answer = "", []string{}
+	}
+
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Q:"):
+			flush()
+			question = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "A:"):
+			answer = append(answer, strings.TrimSpace(line[2:]))
+		case line != "" && len(answer) > 0: // answers may continue over several lines
+			answer = append(answer, line)
+		}
+	}
+	flush()
+}
+
+func (kb *knowledgeBase) addMarkdown(source string, contents string) {
+	heading := ""
+	for _, block := range kbBlock.Split(contents, -1) {
+		block = strings.TrimSpace(block)
+		if strings.HasPrefix(block, "#") { // headings describe the passages beneath them
+			lines := strings.SplitN(block, "\n", 2)
+			heading = SpeakableText(lines[0])
+			block = ""
+			if len(lines) > 1 {
+				block = strings.TrimSpace(lines[1])
+			}
+		}
+		if block != "" {
+			kb.add(source, heading+" "+block, SpeakableText(block))
+		}
+	}
+}
+
+func (kb *knowledgeBase) add(source string, indexed string, answer string) {
+	terms := Terms(indexed)
+	if len(terms) == 0 || answer == "" {
+		return
+	}
+
+	passage := kbPassage{Source: source, Answer: answer, Terms: map[string]int{}, Length: len(terms)}
+	for _, term := range terms {
+		if passage.Terms[term] == 0 {
+			kb.documentFreq[term]++
+		}
+		passage.Terms[term]++
+	}
+	kb.passages = append(kb.passages, passage)
+}
+
+func (kb *knowledgeBase) Answer(textQuery string) ([]byte, error, int) {
+	println(textQuery) // check the question
+
+	best, bestScore := -1, 0.0
+	for i, passage := range kb.passages {
+		if score := kb.score(passage, Terms(textQuery)); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best < 0 || bestScore < kbMinScore {
+		err := errors.New("The knowledge base has no passage that answers this question.")
+		return nil, err, http.StatusNotImplemented // the same status wolfram alpha uses for no short answer
+	}
+
+	answer := TrimForSpeech(kb.passages[best].Answer, kbMaxChars)
+	println(kb.passages[best].Source+":", answer)
+
+	return []byte(answer), nil, 0
+}
+
+// score ranks a passage against the query terms with Okapi BM25.
+func (kb *knowledgeBase) score(passage kbPassage, queryTerms []string) float64 {
+	score := 0.0
+	n := float64(len(kb.passages))
+	for _, term := range queryTerms {
+		freq := float64(passage.Terms[term])
+		if freq == 0 {
+			continue
+		}
+		docFreq := float64(kb.documentFreq[term])
+		idf := math.Log(1 + (n-docFreq+0.5)/(docFreq+0.5))
+		score += idf * freq * (BM25_K1 + 1) /
+			(freq + BM25_K1*(1-BM25_B+BM25_B*float64(passage.Length)/kb.averageLength))
+	}
+	return score
+}
+
+func Terms(text string) []string {
+	terms := []string{}
+	for _, word := range kbWord.FindAllString(strings.ToLower(text), -1) {
+		if !kbStopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// SpeakableText removes markdown formatting that would otherwise be read aloud.
+func SpeakableText(markdown string) string {
+	text := kbLink.ReplaceAllString(markdown, "$1")
+	text = kbMarkup.ReplaceAllString(text, "")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// TrimForSpeech shortens an answer to at most maxChars, ending at a sentence where possible.
+func TrimForSpeech(answer string, maxChars int) string {
+	if len(answer) <= maxChars {
+		return answer
+	}
+
+	cut := answer[:maxChars]
+	for cut != "" && !utf8.RuneStart(answer[len(cut)]) { // never split a character written in several bytes
+		cut = cut[:len(cut)-1]
+	}
+	ends := kbSentence.FindAllStringIndex(cut, -1)
+	if len(ends) > 0 {
+		return strings.TrimSpace(cut[:ends[len(ends)-1][0]+1])
+	}
+	if space := strings.LastIndex(cut, " "); space > 0 {
+		cut = cut[:space]
+	}
+	return strings.TrimSpace(cut) + "..."
+}
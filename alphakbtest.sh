@@ -0,0 +1,28 @@
+#!/bin/sh
+# Checks the knowledge base ranks and trims its answers, start alpha on the test knowledge base first:
+#   mkdir kb && cp alphakbtest.qa alphakbtest.md kb
+#   ALPHA_BACKEND=kb ALPHA_FALLBACKS=kb ALPHA_KB_DIR=kb ALPHA_KB_MAX_CHARS=110 go run alpha.go ...
+FAILED=0
+
+check() { # check <description> <question> <expected text in response> [<text that must not appear>]
+	echo "{\"text\":\"$2\"}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3001/alpha`
+	if [ "$STATUS" = "200" ] && grep -q -- "$3" output && { [ -z "$4" ] || ! grep -q -- "$4" output; }; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `cat output`"
+		FAILED=1
+	fi
+}
+
+check "best question" "Where is the office?" '"text":"The office is at 12 High Street, Exeter, on the second floor above the bakery."'
+check "rarer terms rank higher" "What is the wifi password for the office?" '"text":"Ask the front desk'
+check "markdown passage under its heading" "Where can staff park?" '"text":"Staff can park in the multi-storey car park on Princesshay, visitors should use the park and ride."'
+check "markdown formatting removed" "Are dogs welcome?" '"text":"Dogs are welcome in the office on Fridays, as long as they are quiet."'
+check "source of the answer" "Are dogs welcome?" '"source":"kb"'
+check "trimmed at a sentence" "When is the office open?" '"text":"The office is open from nine until five on weekdays."'
+check "trimmed within a word" "How do you say good morning in Japanese?" '"text":"おはようございます[^"]*\.\.\."' "`printf '\357\277\275'`"
+check "no passage" "Who won the world cup in 1966?" '"source":"none"'
+
+rm -f input output
+exit $FAILED
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Transcripts arrive as spoken, e.g. "Alexa, um, please tell me how far is Paris from London."
+// NormalizeQuery cleans them up before they are asked, and Reformulations gives simpler versions
+// of the question to try when there is no answer. Every change is logged for tuning the lists.
+
+var (
+	wakeWords = EnvList("ALPHA_WAKE_WORDS", []string{"hey alexa", "ok alexa", "okay alexa", "alexa"})
+	fillers   = EnvList("ALPHA_FILLERS", []string{"um", "umm", "uh", "er", "erm", "hmm", "you know", "i mean"})
+	// leading phrases that wrap the question, removed one at a time when reformulating
+	wrappers = EnvList("ALPHA_WRAPPERS", []string{"please", "could you", "can you", "would you", "tell me", "show me",
+		"give me", "do you know", "i want to know", "i'd like to know", "i wonder"})
+	// contractions expanded when reformulating, written as from=to
+	expansions = EnvList("ALPHA_EXPANSIONS", []string{"what's=what is", "who's=who is", "where's=where is",
+		"how's=how is", "when's=when is", "how far's=how far is"})
+
+	wakeWordPattern = PhrasePattern(`^\s*(`, wakeWords, `)\b[\s,.!]*`)
+	fillerPattern   = PhrasePattern(`(?:^|,)\s*(`, fillers, `)\s*(?:,|([.?!]*)\s*$)`)
+	leadingFiller   = PhrasePattern(`^\s*(`, fillers, `)\b[\s,]*`)
+	trailingFiller  = PhrasePattern(`\s+(`, fillers, `)\s*([.?!]*)\s*$`)
+	wrapperPattern  = PhrasePattern(`^\s*(`, wrappers, `)\b[\s,]*`)
+	wrapperAtEnd    = PhrasePattern(`\b(`, wrappers, `)$`)
+	spaceBefore     = regexp.MustCompile(`\s+([,.?!])`)
+	repeated        = regexp.MustCompile(`([,.?!])[,.?!]+`)
+	leadingPunct    = regexp.MustCompile(`^[\s,.?!]+`)
+	questionWords   = []string{"what", "what's", "who", "who's", "where", "where's", "when", "why", "how", "which", "is", "are", "can", "does", "do", "will"}
+)
+
+// PhrasePattern builds a case insensitive pattern matching any of the configured phrases.
+func PhrasePattern(prefix string, phrases []string, suffix string) *regexp.Regexp {
+	quoted := []string{}
+	for _, phrase := range phrases {
+		quoted = append(quoted, strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(phrase)), " ", `\s+`))
+	}
+	if len(quoted) == 0 {
+		return regexp.MustCompile(`$^`) // matches nothing
+	}
+	return regexp.MustCompile(`(?i)` + prefix + strings.Join(quoted, "|") + suffix)
+}
+
+func NormalizeQuery(textQuery string) string {
+	query := textQuery
+	query = LogTransform("wake word", query, wakeWordPattern.ReplaceAllString(query, ""))
+	query = LogTransform("fillers", query, StripFillers(query))
+	query = LogTransform("punctuation", query, FixPunctuation(query))
+	query = LogTransform("casing", query, FixCasing(query))
+	return query
+}
+
+// StripFillers removes fillers at either end of the question or standing alone between commas, but
+// not those ending a wrapper, so the "you know" in "do you know" is left for the wrappers. It repeats
+// until none are left, as one filler's comma can be the next one's.
+func StripFillers(query string) string {
+	for {
+		stripped := fillerPattern.ReplaceAllString(query, " $2")
+		stripped = leadingFiller.ReplaceAllString(stripped, "")
+		if end := trailingFiller.FindStringSubmatchIndex(stripped); end != nil && !wrapperAtEnd.MatchString(stripped[:end[3]]) {
+			stripped = stripped[:end[0]] + stripped[end[4]:end[5]] // keeps the question mark
+		}
+		if stripped == query {
+			return query
+		}
+		query = stripped
+	}
+}
+
+func FixPunctuation(query string) string {
+	query = leadingPunct.ReplaceAllString(query, "")
+	query = spaceBefore.ReplaceAllString(query, "$1")
+	query = repeated.ReplaceAllString(query, "$1")
+	query = strings.Join(strings.Fields(query), " ")
+	query = strings.TrimRight(query, ",")
+
+	firstWord := strings.ToLower(strings.SplitN(query, " ", 2)[0])
+	if Contains(questionWords, firstWord) && !strings.HasSuffix(query, "?") {
+		query = strings.TrimRight(query, ".!") + "?" // recognition often ends questions with a full stop
+	}
+	return query
+}
+
+// FixCasing capitalises the first letter, lowering transcripts that came back in capitals.
+func FixCasing(query string) string {
+	if query == "" {
+		return query
+	}
+	if strings.ToUpper(query) == query && strings.ToLower(query) != query {
+		query = strings.ToLower(query)
+	}
+	runes := []rune(query)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// Reformulations returns progressively simpler versions of the question, without those that are
+// the same as the question apart from punctuation.
+func Reformulations(query string) []string {
+	candidates := []string{}
+	seen := map[string]bool{strings.ToLower(strings.TrimRight(query, "?.! ")): true}
+	add := func(step string, candidate string) {
+		candidate = FixCasing(FixPunctuation(candidate))
+		key := strings.ToLower(strings.TrimRight(candidate, "?.! "))
+		if key != "" && !seen[key] {
+			seen[key] = true
+			candidates = append(candidates, candidate)
+			println("Reformulation (" + step + "): '" + query + "' -> '" + candidate + "'")
+		}
+	}
+
+	current := query
+	for wrapperPattern.MatchString(current) { // peel the wrapping phrases off one at a time
+		current = wrapperPattern.ReplaceAllString(current, "")
+		add("wrapper", current)
+	}
+
+	expanded := current
+	for _, expansion := range expansions {
+		parts := strings.SplitN(expansion, "=", 2)
+		if len(parts) == 2 {
+			expanded = regexp.MustCompile(`(?i)\b`+regexp.QuoteMeta(parts[0])+`\b`).ReplaceAllString(expanded, parts[1])
+		}
+	}
+	add("expansion", expanded)
+
+	return candidates
+}
+
+func LogTransform(step string, before string, after string) string {
+	if after != before {
+		println("Normalized (" + step + "): '" + before + "' -> '" + after + "'")
+	}
+	return after
+}
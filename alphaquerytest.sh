@@ -0,0 +1,35 @@
+#!/bin/sh
+# Checks questions are cleaned up and reformulated before they are asked, start azurestub.go and alpha with
+#   ALPHA_ENDPOINT=http://localhost:3010/v1/result WOLFRAM_APPID=stub ALPHA_FALLBACKS=spoken,reformulate go run alpha.go ...
+# The stand-in only answers "How far is Paris from London?" and "What is the capital of France?" as written.
+FAILED=0
+
+check() { # check <description> <question> <expected text in response>
+	printf '{"text":"%s"}' "$2" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3001/alpha`
+	if [ "$STATUS" = "200" ] && grep -q -- "$3" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `cat output`"
+		FAILED=1
+	fi
+}
+
+check "question as written" "How far is Paris from London?" '"source":"wolfram","text":"about 214 miles"'
+check "wake word" "Alexa, how far is Paris from London?" '"source":"wolfram"'
+check "wake word without a comma" "hey alexa what is the capital of France?" '"source":"wolfram"'
+check "filler between commas" "Alexa, um, how far is Paris from London?" '"source":"wolfram"'
+check "several fillers" "Um, er, how far is Paris from London?" '"source":"wolfram"'
+check "filler at the end" "What is the capital of France, you know?" '"source":"wolfram"'
+check "full stop made a question mark" "how far is Paris from London." '"source":"wolfram"'
+check "wrapper removed" "Please tell me how far is Paris from London" '"source":"reformulate","text":"about 214 miles"'
+check "wrapper that looks like a filler" "Do you know what is the capital of France?" '"source":"reformulate","text":"Paris'
+check "filler then wrapper" "Alexa, um, could you tell me what is the capital of France?" '"source":"reformulate"'
+check "contraction expanded" "What's the capital of France?" '"source":"reformulate"'
+check "filler at the start without a comma" "um how far is Paris from London" '"source":"wolfram"'
+check "filler at the end without a comma" "How far is Paris from London you know?" '"source":"wolfram"'
+check "filler before a wrapper" "Um do you know what is the capital of France" '"source":"reformulate"'
+check "no answer" "Who won the world cup in 1966?" '"source":"none","text":"Sorry, I don'"'"'t know the answer to that."'
+
+rm -f input output
+exit $FAILED
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A local stand-in for the microsoft speech services, so the microservices can be tested without
+// a subscription key or network access. Point a service at it with e.g.
+// STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1
+// TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1
+// SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken
+// ALEXA_TRANSLATOR_ENDPOINT=http://localhost:3010/translate
+// ALPHA_ENDPOINT=http://localhost:3010/v1/result for wolfram alpha, which isn't a microsoft service
+// Every path can also be prefixed with a region, e.g. http://localhost:3010/{region}/cognitiveservices/v1,
+// and the regions listed in STUB_DOWN_REGIONS answer 503 to test failover.
+
+const (
+	STUB_TRANSCRIPT     = "damn what is the melting point of silver" // lexical form of every recognition
+	STUB_TOKEN_LIFETIME = 10 * time.Minute
+)
+
+var (
+	stubDownRegions = strings.Split(os.Getenv("STUB_DOWN_REGIONS"), ",")
+
+	stubMu     sync.Mutex
+	stubTokens = map[string]time.Time{} // issued tokens and their expiry
+	stubIssued = 0
+	stubSSML   = []byte{} // the last document synthesised, so tests can check the markup
+)
+
+func StubIssueToken(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Header["Ocp-Apim-Subscription-Key"]; !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	stubMu.Lock()
+	stubIssued++
+	token := "stub-token-" + strconv.Itoa(stubIssued)
+	stubTokens[token] = time.Now().Add(STUB_TOKEN_LIFETIME)
+	stubMu.Unlock()
+
+	println("Issued " + token)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(token))
+}
+
+// StubRevokeTokens expires every issued token, so the next request has to fetch a fresh one.
+func StubRevokeTokens(w http.ResponseWriter, r *http.Request) {
+	stubMu.Lock()
+	stubTokens = map[string]time.Time{}
+	stubMu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func StubAuthorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	stubMu.Lock()
+	defer stubMu.Unlock()
+	expiry, ok := stubTokens[token]
+	return ok && time.Now().Before(expiry)
+}
+
+func StubRecognition(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	println(r.URL.RawQuery) // check the options sent by the microservice
+
+	if !StubAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	speech, err := ioutil.ReadAll(r.Body)
+	if err != nil || len(speech) < 4 || string(speech[0:4]) != "RIFF" {
+		w.WriteHeader(http.StatusBadRequest) // microsoft rejects audio it can't read
+		return
+	}
+
+	if query.Get("language") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("format") != "" && query.Get("format") != "simple" && query.Get("format") != "detailed" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	swearWord := "damn"
+	switch query.Get("profanity") {
+	case "", "masked":
+		swearWord = "****"
+	case "removed":
+		swearWord = ""
+	case "raw":
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	lexical := STUB_TRANSCRIPT
+	if query.Get("cid") != "" { // a custom model knows our vocabulary
+		lexical = strings.Replace(lexical, "silver", "sterling silver", 1)
+	}
+	masked := strings.TrimSpace(strings.Replace(lexical, "damn", swearWord, 1))
+	display := strings.ToUpper(masked[0:1]) + masked[1:] + "?"
+
+	alternative := map[string]interface{}{
+		"Confidence": StubConfidence(speech),
+		"Lexical":    lexical,
+		"ITN":        lexical,
+		"MaskedITN":  masked,
+		"Display":    display,
+	}
+	if query.Get("wordLevelTimestamps") == "true" {
+		words := []map[string]interface{}{}
+		offset := int64(1000000)
+		for _, word := range strings.Fields(lexical) {
+			duration := int64(len(word)) * 800000 // roughly 80ms per letter
+			words = append(words, map[string]interface{}{"Word": word, "Offset": offset, "Duration": duration})
+			offset += duration + 500000
+		}
+		alternative["Words"] = words
+	}
+
+	if r.Header.Get("Pronunciation-Assessment") != "" {
+		assessment := struct{ ReferenceText string }{}
+		assessmentJSON, err := base64.StdEncoding.DecodeString(r.Header.Get("Pronunciation-Assessment"))
+		if err != nil || json.Unmarshal(assessmentJSON, &assessment) != nil || assessment.ReferenceText == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		StubAssessment(alternative, lexical, assessment.ReferenceText)
+	}
+
+	u := map[string]interface{}{
+		"RecognitionStatus": "Success",
+		"Offset":            1000000,
+		"Duration":          32000000,
+		"DisplayText":       display,
+		"NBest":             []interface{}{alternative},
+	}
+	if query.Get("format") != "detailed" {
+		u = map[string]interface{}{"RecognitionStatus": "Success", "Offset": 1000000, "Duration": 32000000, "DisplayText": display}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(u)
+}
+
+// StubConfidence is 0.93 for clear speech and 0.41 for audio too quiet to be sure of, whose samples
+// never reach 1000, so tests can cover both sides of STT_CONFIDENCE_THRESHOLD.
+func StubConfidence(speech []byte) float64 {
+	for pos := 44; pos+1 < len(speech); pos += 2 { // the samples after a canonical 44 byte header
+		if sample := int16(binary.LittleEndian.Uint16(speech[pos:])); sample > 1000 || sample < -1000 {
+			return 0.93
+		}
+	}
+	return 0.41
+}
+
+// StubAssessment scores every spoken word found in the reference text as perfect and the rest as mispronounced.
+func StubAssessment(alternative map[string]interface{}, lexical string, referenceText string) {
+	reference := strings.Fields(strings.ToLower(strings.Trim(referenceText, ".?!")))
+	spoken := strings.Fields(lexical)
+	words := []map[string]interface{}{}
+	matched, total := 0, 0.0
+	for _, word := range spoken {
+		score, errorType := 60.0, "Mispronunciation"
+		for _, referenceWord := range reference {
+			if word == referenceWord {
+				score, errorType = 100.0, "None"
+				matched++
+				break
+			}
+		}
+		words = append(words, map[string]interface{}{"Word": word, "AccuracyScore": score, "ErrorType": errorType})
+		total += score
+	}
+
+	alternative["AccuracyScore"] = total / float64(len(spoken))
+	alternative["FluencyScore"] = 90.0
+	alternative["CompletenessScore"] = 100.0 * float64(matched) / float64(len(reference))
+	alternative["PronScore"] = (alternative["AccuracyScore"].(float64) + 90.0 + alternative["CompletenessScore"].(float64)) / 3
+	alternative["Words"] = words
+}
+
+// StubSynthesis speaks every request as a quiet tone, roughly as long as the text would take to say.
+func StubSynthesis(w http.ResponseWriter, r *http.Request) {
+	if !StubAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	textSSML, err := ioutil.ReadAll(r.Body)
+	format := r.Header.Get("X-Microsoft-OutputFormat")
+	sampleRate, mimeType := StubFormat(format)
+	if err != nil || mimeType == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	stubMu.Lock()
+	stubSSML = textSSML
+	stubMu.Unlock()
+
+	characters := 0
+	decoder := xml.NewDecoder(bytes.NewReader(textSSML))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil { // microsoft rejects malformed ssml
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if text, ok := token.(xml.CharData); ok {
+			characters += len(strings.TrimSpace(string(text)))
+		}
+	}
+
+	samples := characters * sampleRate * 60 / 1000 // 60ms per character
+	var buf bytes.Buffer
+	switch {
+	case strings.HasPrefix(format, "riff-"):
+		buf.WriteString("RIFF")
+		binary.Write(&buf, binary.LittleEndian, uint32(36+2*samples))
+		buf.WriteString("WAVEfmt ")
+		binary.Write(&buf, binary.LittleEndian, []uint32{16})
+		binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+		binary.Write(&buf, binary.LittleEndian, []uint32{uint32(sampleRate), uint32(2 * sampleRate)})
+		binary.Write(&buf, binary.LittleEndian, []uint16{2, 16})
+		buf.WriteString("data")
+		binary.Write(&buf, binary.LittleEndian, uint32(2*samples))
+		fallthrough
+	case strings.HasPrefix(format, "raw-"):
+		for i := 0; i < samples; i++ {
+			binary.Write(&buf, binary.LittleEndian, int16(3000*math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate))))
+		}
+	default: // compressed formats are only the magic number of the container followed by silence
+		magic := map[string]string{"audio/mpeg": "ID3", "audio/ogg": "OggS", "audio/webm": "\x1a\x45\xdf\xa3"}[mimeType]
+		buf.WriteString(magic)
+		buf.Write(make([]byte, characters*100))
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// StubFormat reads the sample rate and mime type of the supported 16-bit mono formats, such as
+// riff-24khz-16bit-mono-pcm or audio-48khz-96kbitrate-mono-mp3, returning no mime type for others.
+func StubFormat(format string) (int, string) {
+	parts := strings.Split(format, "-")
+	if len(parts) < 4 {
+		return 0, ""
+	}
+
+	rate := 0
+	if strings.HasSuffix(parts[1], "khz") {
+		rate, _ = strconv.Atoi(strings.TrimSuffix(parts[1], "khz"))
+		rate *= 1000
+	} else if strings.HasSuffix(parts[1], "hz") {
+		rate, _ = strconv.Atoi(strings.TrimSuffix(parts[1], "hz"))
+	}
+
+	switch {
+	case rate == 0:
+		return 0, ""
+	case (parts[0] == "riff" || parts[0] == "raw") && strings.HasSuffix(format, "-16bit-mono-pcm"):
+		return rate, "audio/wav"
+	case parts[0] == "audio" && strings.HasSuffix(format, "-mono-mp3"):
+		return rate, "audio/mpeg"
+	case parts[0] == "ogg" && strings.HasSuffix(format, "-mono-opus"):
+		return rate, "audio/ogg"
+	case parts[0] == "webm" && strings.HasSuffix(format, "-mono-opus"):
+		return rate, "audio/webm"
+	}
+	return 0, ""
+}
+
+// StubLastSSML returns the last document sent for synthesis.
+func StubLastSSML(w http.ResponseWriter, r *http.Request) {
+	stubMu.Lock()
+	defer stubMu.Unlock()
+	w.Header().Set("Content-Type", "application/ssml+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(stubSSML)
+}
+
+// StubVoices lists a few of microsoft's neural voices in the shape of voices/list.
+func StubVoices(w http.ResponseWriter, r *http.Request) {
+	if !StubAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	emotions := []string{"angry", "cheerful", "excited", "friendly", "hopeful", "sad", "shouting", "terrified", "unfriendly", "whispering"}
+	voices := []map[string]interface{}{
+		{"ShortName": "en-US-JennyNeural", "DisplayName": "Jenny", "Gender": "Female", "Locale": "en-US",
+			"StyleList": append([]string{"assistant", "chat", "customerservice", "newscast"}, emotions...)},
+		{"ShortName": "en-US-GuyNeural", "DisplayName": "Guy", "Gender": "Male", "Locale": "en-US",
+			"StyleList": append([]string{"newscast"}, emotions...)},
+		{"ShortName": "en-US-AriaNeural", "DisplayName": "Aria", "Gender": "Female", "Locale": "en-US",
+			"StyleList": append([]string{"chat", "customerservice", "empathetic", "narration-professional", "newscast-casual", "newscast-formal"}, emotions...)},
+		{"ShortName": "en-GB-SoniaNeural", "DisplayName": "Sonia", "Gender": "Female", "Locale": "en-GB", "StyleList": []string{"cheerful", "sad"}},
+		{"ShortName": "en-GB-RyanNeural", "DisplayName": "Ryan", "Gender": "Male", "Locale": "en-GB", "StyleList": []string{"chat", "cheerful"}},
+		{"ShortName": "en-GB-LibbyNeural", "DisplayName": "Libby", "Gender": "Female", "Locale": "en-GB"},
+		{"ShortName": "en-AU-NatashaNeural", "DisplayName": "Natasha", "Gender": "Female", "Locale": "en-AU"},
+		{"ShortName": "en-IE-EmilyNeural", "DisplayName": "Emily", "Gender": "Female", "Locale": "en-IE"},
+		{"ShortName": "en-IN-PrabhatNeural", "DisplayName": "Prabhat", "Gender": "Male", "Locale": "en-IN"},
+		{"ShortName": "de-DE-KatjaNeural", "DisplayName": "Katja", "Gender": "Female", "Locale": "de-DE"},
+		{"ShortName": "cy-GB-NiaNeural", "DisplayName": "Nia", "Gender": "Female", "Locale": "cy-GB"},
+	}
+	for _, voice := range voices {
+		voice["Name"] = "Microsoft Server Speech Text to Speech Voice (" + voice["Locale"].(string) + ", " +
+			strings.SplitN(voice["ShortName"].(string), "-", 3)[2] + ")"
+		voice["VoiceType"], voice["SampleRateHertz"], voice["Status"] = "Neural", "24000", "GA"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(voices)
+}
+
+// StubTranslate stands in for microsoft translator, marking the text with the language it was
+// translated to rather than translating it, e.g. [de] The answer
+func StubTranslate(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Ocp-Apim-Subscription-Key") == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	to := r.URL.Query().Get("to")
+	texts := []struct{ Text string }{}
+	if err := json.NewDecoder(r.Body).Decode(&texts); err != nil || to == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	translations := []interface{}{}
+	for _, text := range texts {
+		translations = append(translations, map[string]interface{}{
+			"translations": []map[string]string{{"text": "[" + to + "] " + text.Text, "to": to}},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(translations)
+}
+
+// stubAnswers are the only questions the wolfram alpha stand-in can answer, asked exactly as written,
+// so tests can tell whether a question was cleaned up or reformulated before it was asked.
+var stubAnswers = map[string]string{
+	"How far is Paris from London?":  "about 214 miles",
+	"What is the capital of France?": "Paris, Ile-de-France, France",
+}
+
+// StubAlpha stands in for wolfram alpha's short answers and spoken results, answering 501 for
+// every question it doesn't know and 403 without an appid.
+func StubAlpha(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("appid") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	answer, found := stubAnswers[r.URL.Query().Get("i")]
+	if !found {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("No short answer available"))
+		return
+	}
+	if mux.Vars(r)["api"] == "spoken" {
+		answer = "The answer is " + answer
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(answer))
+}
+
+// StubRegion answers 503 for the regions configured to be down.
+func StubRegion(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		region := mux.Vars(r)["region"]
+		for _, down := range stubDownRegions {
+			if region != "" && region == down {
+				println("Region " + region + " is down")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+func StubHandler() {
+	r := mux.NewRouter()
+	for _, prefix := range []string{"", "/{region}"} {
+		r.HandleFunc(prefix+"/sts/v1.0/issueToken", StubRegion(StubIssueToken)).Methods("POST")
+		r.HandleFunc(prefix+"/speech/recognition/conversation/cognitiveservices/v1", StubRegion(StubRecognition)).Methods("POST")
+		r.HandleFunc(prefix+"/cognitiveservices/v1", StubRegion(StubSynthesis)).Methods("POST")
+		r.HandleFunc(prefix+"/cognitiveservices/voices/list", StubRegion(StubVoices)).Methods("GET")
+	}
+	r.HandleFunc("/translate", StubTranslate).Methods("POST") // microsoft translator is a global endpoint
+	r.HandleFunc("/v1/{api:result|spoken}", StubAlpha).Methods("GET")
+	r.HandleFunc("/stub/revoke", StubRevokeTokens).Methods("POST") // not part of microsoft's api
+	r.HandleFunc("/stub/ssml", StubLastSSML).Methods("GET")
+	http.ListenAndServe(":3010", r)
+}
+
+// go run azurestub.go
+func main() {
+	StubHandler()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvString reads a deployment setting from the environment, falling back to def when it is unset.
+func EnvString(name, def string) string {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// EnvList reads a comma separated deployment setting, e.g. STT_LANGUAGES=en-US,cy-GB,de-DE
+func EnvList(name string, def []string) []string {
+	value := EnvString(name, "")
+	if value == "" {
+		return def
+	}
+
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// EnvFloat reads a numeric deployment setting, ignoring values that don't parse.
+func EnvFloat(name string, def float64) float64 {
+	value, err := strconv.ParseFloat(EnvString(name, ""), 64)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// EnvBool reads an on/off deployment setting such as STT_WORD_TIMESTAMPS=true
+func EnvBool(name string, def bool) bool {
+	value, err := strconv.ParseBool(EnvString(name, ""))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// EnvDuration reads a deployment setting written as a go duration, e.g. SECRETS_RELOAD=30s
+func EnvDuration(name string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(EnvString(name, ""))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+func Contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys are read, in order of preference, from an environment variable such as SPEECH_KEY, a file
+// named by SPEECH_KEY_FILE, or a file called SPEECH_KEY or speech_key in the mounted secrets
+// directory. Files are re-read periodically so rotated keys take effect without a restart.
+
+var (
+	secretsDir    = EnvString("SECRETS_DIR", "/run/secrets")
+	secretsReload = EnvDuration("SECRETS_RELOAD", time.Minute)
+
+	loadedSecretsMu sync.Mutex
+	loadedSecrets   = []*Secret{} // every secret in use, so they can be redacted from messages
+)
+
+type Secret struct {
+	name string
+
+	mu     sync.RWMutex
+	value  string
+	source string
+}
+
+// MustLoadSecret loads a key at startup and exits with an explanation if it isn't configured.
+func MustLoadSecret(name string) *Secret {
+	secret := &Secret{name: name}
+	value, source := secret.read()
+	if value == "" {
+		println("No " + name + " configured - set the " + name + " environment variable, point " + name + "_FILE " +
+			"at a file containing it, or mount it as " + filepath.Join(secretsDir, strings.ToLower(name)))
+		os.Exit(1)
+	}
+
+	secret.value, secret.source = value, source
+	println("Loaded " + name + " from " + source) // never print the value itself
+
+	loadedSecretsMu.Lock()
+	loadedSecrets = append(loadedSecrets, secret)
+	loadedSecretsMu.Unlock()
+
+	if secretsReload > 0 && source != "environment" { // the environment can't change while we run
+		go secret.watch()
+	}
+
+	return secret
+}
+
+func (secret *Secret) Value() string {
+	secret.mu.RLock()
+	defer secret.mu.RUnlock()
+	return secret.value
+}
+
+func (secret *Secret) read() (string, string) {
+	if value := strings.TrimSpace(os.Getenv(secret.name)); value != "" {
+		return value, "environment"
+	}
+
+	paths := []string{}
+	if file := EnvString(secret.name+"_FILE", ""); file != "" {
+		paths = append(paths, file)
+	}
+	paths = append(paths, filepath.Join(secretsDir, secret.name), filepath.Join(secretsDir, strings.ToLower(secret.name)))
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(contents)) != "" {
+			return strings.TrimSpace(string(contents)), path
+		}
+	}
+
+	return "", ""
+}
+
+func (secret *Secret) watch() {
+	for range time.Tick(secretsReload) {
+		value, source := secret.read()
+		if value == "" { // keep the old key while a rotation is half way through
+			println("Could not reload " + secret.name + ", keeping the current key")
+			continue
+		}
+
+		secret.mu.Lock()
+		changed := value != secret.value
+		secret.value, secret.source = value, source
+		secret.mu.Unlock()
+
+		if changed {
+			println("Reloaded " + secret.name + " from " + source)
+		}
+	}
+}
+
+// RedactSecrets hides any loaded key in a message before it is logged or returned, e.g. the appid
+// in the url of a failed wolfram alpha request.
+func RedactSecrets(message string) string {
+	loadedSecretsMu.Lock()
+	defer loadedSecretsMu.Unlock()
+
+	for _, secret := range loadedSecrets {
+		if value := secret.Value(); value != "" {
+			message = strings.ReplaceAll(message, value, "[REDACTED]")
+		}
+	}
+	return message
+}
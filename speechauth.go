@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shared by the speech-to-text and text-to-speech microservices.
+
+const (
+	TOKEN_URI     = "https://{region}.api.cognitive.microsoft.com/sts/v1.0/issueToken"
+	TOKEN_REFRESH = 9 * time.Minute // microsoft tokens expire after 10 minutes, so refresh them early
+)
+
+var speechKey *Secret // loaded by main
+
+// TokenSource exchanges the subscription key for bearer tokens and caches them until they are due to expire.
+type TokenSource struct {
+	endpoint string
+	key      func() string // read on every refresh so a rotated key is picked up
+	client   *http.Client
+
+	mu        sync.Mutex
+	token     string
+	tokenKey  string // the key the cached token was issued for
+	refreshAt time.Time
+}
+
+func NewTokenSource(endpoint string, key func() string) *TokenSource {
+	return &TokenSource{endpoint: endpoint, key: key, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Token returns a cached token, or issues a new one. When microsoft refuses to issue a token its
+// response is returned instead, so the caller can report the status as it would for any other request.
+func (tokens *TokenSource) Token() (string, *http.Response, error) {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	key := tokens.key()
+	if tokens.token != "" && key == tokens.tokenKey && time.Now().Before(tokens.refreshAt) {
+		return tokens.token, nil, nil
+	}
+
+	issuedAt := time.Now()
+	tokenReq, err := http.NewRequest("POST", tokens.endpoint, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	tokenReq.Header.Set("Ocp-Apim-Subscription-Key", key)
+
+	tokenResp, err := tokens.client.Do(tokenReq)
+	if err != nil {
+		return "", nil, err // the token service could not be reached
+	}
+
+	if tokenResp.StatusCode != http.StatusOK {
+		return "", tokenResp, nil
+	}
+
+	defer tokenResp.Body.Close()
+
+	token, err := ioutil.ReadAll(tokenResp.Body) // the token is returned as plain text
+	if err != nil {
+		return "", nil, err
+	}
+	if len(token) == 0 {
+		return "", nil, errors.New("The token service returned an empty token!")
+	}
+
+	tokens.token = strings.TrimSpace(string(token))
+	tokens.tokenKey = key
+	tokens.refreshAt = issuedAt.Add(TOKEN_REFRESH)
+
+	println("Issued a new speech token")
+
+	return tokens.token, nil, nil
+}
+
+// Invalidate discards the cached token if it is still the one that was rejected.
+func (tokens *TokenSource) Invalidate(token string) {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	if tokens.token == token {
+		tokens.token = ""
+	}
+}
+
+// DoAuthorized sends the request with a bearer token. If microsoft answers 401 the token is
+// discarded and the request is sent once more with a fresh token, so the request body must be
+// replayable, as it is for requests made by http.NewRequest from a bytes reader or buffer.
+func DoAuthorized(client *http.Client, tokens *TokenSource, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		token, tokenResp, err := tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tokenResp != nil { // the subscription key was refused
+			return tokenResp, nil
+		}
+
+		attemptReq := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if attemptReq.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		attemptReq.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := client.Do(attemptReq)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || attempt == 2 {
+			return resp, err
+		}
+
+		resp.Body.Close()
+		tokens.Invalidate(token) // revoked or expired early, retry with a new token
+	}
+}
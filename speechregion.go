@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoints are written with a {region} placeholder, e.g. https://{region}.tts.speech.microsoft.com/cognitiveservices/v1
+// An override without the placeholder, such as a local emulator, is a single endpoint with nowhere to fail over to.
+
+var (
+	primaryRegion   = EnvString("SPEECH_REGION", "uksouth")
+	fallbackRegions = EnvList("SPEECH_FALLBACK_REGIONS", []string{}) // tried in order when a region is down
+	speechTimeout   = EnvDuration("SPEECH_TIMEOUT", 30*time.Second)
+	tokenEndpoint   = EnvString("SPEECH_TOKEN_ENDPOINT", TOKEN_URI)
+
+	tokenSourcesMu sync.Mutex
+	tokenSources   = map[string]*TokenSource{} // one per token endpoint, tokens are only valid in their own region
+)
+
+type speechRegion struct {
+	Name     string
+	Endpoint string
+	Tokens   *TokenSource
+}
+
+func SpeechRegions(endpoint string) []speechRegion {
+	regions := []speechRegion{}
+	seen := map[string]bool{}
+	for _, name := range append([]string{primaryRegion}, fallbackRegions...) {
+		regionEndpoint := strings.ReplaceAll(endpoint, "{region}", name)
+		if seen[regionEndpoint] {
+			continue
+		}
+		seen[regionEndpoint] = true
+
+		regions = append(regions, speechRegion{
+			Name:     name,
+			Endpoint: regionEndpoint,
+			Tokens:   RegionTokens(strings.ReplaceAll(tokenEndpoint, "{region}", name)),
+		})
+	}
+	return regions
+}
+
+func RegionTokens(endpoint string) *TokenSource {
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+
+	if tokens, ok := tokenSources[endpoint]; ok {
+		return tokens
+	}
+	tokens := NewTokenSource(endpoint, func() string { return speechKey.Value() })
+	tokenSources[endpoint] = tokens
+	return tokens
+}
+
+// DoRegional sends the request to each region in order, moving on when a region can't be reached,
+// times out or answers with a server error. It returns the last response along with the region that sent it.
+func DoRegional(client *http.Client, regions []speechRegion, req *http.Request) (*http.Response, string, error) {
+	var resp *http.Response
+	var err error
+	for i, region := range regions {
+		regionReq := req.Clone(req.Context())
+		regionReq.URL, err = url.Parse(region.Endpoint)
+		if err != nil {
+			return nil, region.Name, err
+		}
+		regionReq.URL.RawQuery = req.URL.RawQuery
+		regionReq.Host = regionReq.URL.Host
+
+		resp, err = DoAuthorized(client, region.Tokens, regionReq)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, region.Name, nil
+		}
+		if i == len(regions)-1 {
+			return resp, region.Name, err // nowhere left to fail over to
+		}
+
+		if err != nil {
+			println("Region " + region.Name + " failed, trying " + regions[i+1].Name + ": " + RedactSecrets(err.Error()))
+		} else {
+			println("Region " + region.Name + " returned " + strconv.Itoa(resp.StatusCode) + ", trying " + regions[i+1].Name)
+			resp.Body.Close()
+		}
+	}
+	return resp, "", err
+}
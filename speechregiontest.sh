@@ -0,0 +1,27 @@
+#!/bin/sh
+# Checks that both speech microservices fail over to the next region, start the stand-in and services with:
+#   STUB_DOWN_REGIONS=uksouth go run azurestub.go
+#   export SPEECH_KEY=stub SPEECH_REGION=uksouth SPEECH_FALLBACK_REGIONS=ukwest
+#   export SPEECH_TOKEN_ENDPOINT=http://localhost:3010/{region}/sts/v1.0/issueToken
+#   STT_ENDPOINT=http://localhost:3010/{region}/speech/recognition/conversation/cognitiveservices/v1 go run stt.go ...
+#   TTS_ENDPOINT=http://localhost:3010/{region}/cognitiveservices/v1 go run tts.go ...
+FAILED=0
+
+echo "{\"speech\":\"`base64 -i speech.wav | tr -d "\n"`\"}" > input
+if curl -s -X POST -d @input localhost:3002/stt | grep -q '"region":"ukwest"'; then
+	echo "PASS speech-to-text failed over to ukwest"
+else
+	echo "FAIL speech-to-text did not fail over"
+	FAILED=1
+fi
+
+echo "{\"text\":\"What is the melting point of silver?\"}" > input
+if curl -s -X POST -d @input localhost:3003/tts | grep -q '"region":"ukwest"'; then
+	echo "PASS text-to-speech failed over to ukwest"
+else
+	echo "FAIL text-to-speech did not fail over"
+	FAILED=1
+fi
+
+rm -f input
+exit $FAILED
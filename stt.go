@@ -8,36 +8,83 @@ import (
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 )
 
 const (
-	REGION = "uksouth"
-	URI    = "https://" + REGION + ".stt.speech.microsoft.com/" +
-		"speech/recognition/conversation/cognitiveservices/v1?" +
-		"language=en-US"
-	KEY = ""
+	URI = "https://{region}.stt.speech.microsoft.com/" +
+		"speech/recognition/conversation/cognitiveservices/v1"
 )
 
+// STT_ENDPOINT overrides URI, e.g. http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 for azurestub.go
+var sttRegions = SpeechRegions(EnvString("STT_ENDPOINT", URI))
+
+// transcripts whose best alternative falls below this confidence are reported as uncertain, 0 accepts everything
+var confidenceThreshold = EnvFloat("STT_CONFIDENCE_THRESHOLD", 0)
+
+// recognitionResult is the detailed output format of microsoft speech-to-text.
+type recognitionResult struct {
+	RecognitionStatus string
+	Offset            int64 // 100-nanosecond units
+	Duration          int64
+	DisplayText       string
+	NBest             []recognitionAlternative
+	Pronunciation     *pronunciationScores `json:"-"` // only present for pronunciation assessment requests
+	Region            string               `json:"-"` // the region that recognised the speech, or local
+	OriginalText      string               `json:"-"` // DisplayText before vocabulary correction
+	Corrections       []vocabCorrection    `json:"-"`
+}
+
+type recognitionAlternative struct {
+	Confidence float64           `json:"confidence"`
+	Lexical    string            `json:"lexical"`         // the recognised words, e.g. "twenty three"
+	ITN        string            `json:"itn"`             // inverse text normalised form, e.g. "23"
+	MaskedITN  string            `json:"maskedItn"`       // the ITN form with profanity masked
+	Display    string            `json:"display"`         // the ITN form with punctuation and capitalisation
+	Words      []recognitionWord `json:"words,omitempty"` // only present when word timestamps are requested
+}
+
+type recognitionWord struct {
+	Word     string `json:"word"`
+	Offset   int64  `json:"offset"` // 100-nanosecond units from the start of the recording
+	Duration int64  `json:"duration"`
+}
+
+type sttRequest struct {
+	Speech []byte
+	recognitionOptions
+}
+
 func ProcessSTT(w http.ResponseWriter, r *http.Request) {
-	decodedSpeech, err, errCode := SpeechDecoding(r)
+	sttReq, err, errCode := SpeechDecoding(r)
 	if err != nil {
 		STTErrResponse(w, err, errCode) // return an error response from the microservice
+		return
 	}
 
-	responseText, err, errCode := SpeechToText(decodedSpeech)
+	var result *recognitionResult
+	language := sttReq.Language
+	if sttReq.Assessment != nil {
+		result, err, errCode = AssessPronunciation(sttReq) // score the speech against the reference text
+	} else {
+		result, language, err, errCode = TranscribeSpeech(sttReq) // long recordings are split into segments
+	}
 	if err != nil {
 		STTErrResponse(w, err, errCode) // return an error response from the microservice
+		return
 	}
 
-	questionText, err, errCode := CheckResponse(responseText)
-	if err != nil {
-		STTErrResponse(w, err, errCode) // return an error response from the microservice
-	} else {
-		STTResponse(w, questionText) // success
+	// product and team names are corrected before they reach wolfram alpha, assessments are
+	// left alone as they are scored against the reference text
+	result.OriginalText, result.Corrections = result.DisplayText, []vocabCorrection{}
+	if sttReq.Assessment == nil {
+		result.DisplayText, result.Corrections = vocabulary.Correct(result.DisplayText)
 	}
+
+	STTResponse(w, result, language) // success, unless microsoft was unsure of the transcript
 }
 
-func SpeechDecoding(r *http.Request) ([]byte, error, int) {
+func SpeechDecoding(r *http.Request) (*sttRequest, error, int) {
 	t := map[string]interface{}{}
 	err := json.NewDecoder(r.Body).Decode(&t)
 	if err != nil {
@@ -65,29 +112,54 @@ func SpeechDecoding(r *http.Request) ([]byte, error, int) {
 		return nil, err, http.StatusBadRequest // could not encode speech due to malformed input, perceived to be client error
 	}
 
-	return decodedSpeech, nil, 0
+	options, err, errCode := RecognitionOptions(t) // optional, the configured defaults are used when absent
+	if err != nil {
+		return nil, err, errCode
+	}
+
+	return &sttRequest{Speech: decodedSpeech, recognitionOptions: options}, nil, 0
+}
+
+func RecognitionURI(options recognitionOptions) string {
+	query := url.Values{}
+	query.Set("language", options.Language)
+	query.Set("format", "detailed") // includes the n-best alternatives and their confidence
+	query.Set("profanity", options.Profanity)
+	if options.EndpointID != "" {
+		query.Set("cid", options.EndpointID)
+	}
+	if options.WordTimestamps {
+		query.Set("wordLevelTimestamps", "true")
+	}
+	return sttRegions[0].Endpoint + "?" + query.Encode() // DoRegional swaps in the fallback endpoints
 }
 
-func SpeechToText(decodedSpeech []byte) ([]byte, error, int) {
-	client := &http.Client{}
-	sttReq, err := http.NewRequest("POST", URI, bytes.NewReader(decodedSpeech))
+func SpeechToText(decodedSpeech []byte, options recognitionOptions) ([]byte, string, error, int) {
+	client := &http.Client{Timeout: speechTimeout} // a region that times out is failed over
+	sttReq, err := http.NewRequest("POST", RecognitionURI(options), bytes.NewReader(decodedSpeech))
 	if err != nil {
-		return nil, err, http.StatusBadRequest // the request was malformed
+		return nil, "", err, http.StatusBadRequest // the request was malformed
 	}
 
 	sttReq.Header.Set("Content-Type", "audio/wav;codecs=audio/pcm;samplerate=16000")
-	sttReq.Header.Set("Ocp-Apim-Subscription-Key", KEY)
+	if options.Assessment != nil {
+		assessmentHeader, err := AssessmentHeader(options.Assessment)
+		if err != nil {
+			return nil, "", err, http.StatusBadRequest // the reference text could not be encoded
+		}
+		sttReq.Header.Set("Pronunciation-Assessment", assessmentHeader)
+	}
 
-	sttResp, err := client.Do(sttReq)
+	sttResp, region, err := DoRegional(client, sttRegions, sttReq) // falls back to the next region on server errors
 	if err != nil {
-		return nil, err, http.StatusNotFound // microsoft speech-to-text could not be reached
+		return nil, region, err, http.StatusNotFound // microsoft speech-to-text could not be reached
 	}
 
 	// the request was not successful
 	if sttResp.StatusCode != http.StatusOK {
 		err = CheckSTTStatusErr(sttResp.StatusCode) // long text error message
 		if err != nil {
-			return nil, err, sttResp.StatusCode // pass the microsoft stt error code to our own microservice response header
+			return nil, region, err, sttResp.StatusCode // pass the microsoft stt error code to our own microservice response header
 		}
 	}
 
@@ -95,41 +167,51 @@ func SpeechToText(decodedSpeech []byte) ([]byte, error, int) {
 
 	responseText, err := ioutil.ReadAll(sttResp.Body)
 	if err != nil {
-		return nil, err, http.StatusInternalServerError // could not read the body of the response, perceived to be client error
+		return nil, region, err, http.StatusInternalServerError // could not read the body of the response, perceived to be client error
 	}
 
 	println(string(responseText))
 
-	return responseText, nil, 0
+	return responseText, region, nil, 0
 }
 
-func CheckResponse(responseText []byte) (string, error, int) {
-	t := map[string]interface{}{}
-	err := json.Unmarshal(responseText, &t)
+func CheckResponse(responseText []byte) (*recognitionResult, error, int) {
+	result := &recognitionResult{}
+	err := json.Unmarshal(responseText, result)
 	if err != nil {
-		return "", err, http.StatusInternalServerError // could not decode json response due to perceived client error
+		return nil, err, http.StatusInternalServerError // could not decode json response due to perceived client error
 	}
 
-	recStatus, ok := t["RecognitionStatus"].(string)
-	if !ok { // RecognitionStatus field is not present
+	if result.RecognitionStatus == "" { // RecognitionStatus field is not present
 		err = errors.New("Object contains no field 'RecognitionStatus'") // handle error for incorrect json object
-		return "", err, http.StatusInternalServerError
+		return nil, err, http.StatusInternalServerError
 	}
 
-	if recStatus != "Success" { // recognition was not successful
-		err = RecognitionErr(recStatus) // microsoft stt api failed to determine the correct text
-		return "", err, http.StatusInternalServerError
+	if result.RecognitionStatus != "Success" { // recognition was not successful
+		err = RecognitionErr(result.RecognitionStatus) // microsoft stt api failed to determine the correct text
+		return nil, err, http.StatusInternalServerError
 	}
 
-	questionText, ok := t["DisplayText"].(string)
-	if !ok { // DisplayText field is not present.
-		err = errors.New("Object contains no field 'DisplayText'") // handle error for incorrect json object
-		return "", err, http.StatusInternalServerError
+	if len(result.NBest) == 0 { // NBest field is not present
+		err = errors.New("Object contains no field 'NBest'") // handle error for incorrect json object
+		return nil, err, http.StatusInternalServerError
 	}
 
-	println(questionText)
+	if result.DisplayText == "" {
+		result.DisplayText = result.NBest[0].Display // the alternatives are ordered best first
+	}
+
+	println(result.DisplayText)
 
-	return questionText, nil, 0
+	return result, nil, 0
+}
+
+// Confidence is the confidence of the best alternative, between 0 and 1.
+func (result *recognitionResult) Confidence() float64 {
+	if len(result.NBest) == 0 {
+		return 0
+	}
+	return result.NBest[0].Confidence
 }
 
 func CheckSTTStatusErr(errStatus int) error {
@@ -166,19 +248,37 @@ func RecognitionErr(recStatus string) error {
 	return errors.New("Microsoft speech-to-text could not determine the recognition error!")
 }
 
-func STTResponse(w http.ResponseWriter, questionText string) {
-	w.WriteHeader(http.StatusOK)
-	u := map[string]interface{}{"text": questionText}
+func STTResponse(w http.ResponseWriter, result *recognitionResult, language string) {
+	status, statusCode := "success", http.StatusOK
+	if result.Confidence() < confidenceThreshold {
+		status, statusCode = "uncertain", http.StatusUnprocessableEntity // the caller decides whether to ask again
+	}
+
+	w.WriteHeader(statusCode)
+	u := map[string]interface{}{
+		"status":       status,
+		"text":         result.DisplayText,
+		"originalText": result.OriginalText,
+		"corrections":  result.Corrections,
+		"language":     language,
+		"confidence":   result.Confidence(),
+		"nbest":        result.NBest,
+		"region":       result.Region,
+	}
+	if result.Pronunciation != nil {
+		u["pronunciation"] = result.Pronunciation
+	}
 	w.Header().Set("Content-Type", "application/json") // return microservice response as json
 	json.NewEncoder(w).Encode(u)
 }
 
 func STTErrResponse(w http.ResponseWriter, err error, errCode int) {
+	message := RedactSecrets(err.Error()) // keys must never reach the console or the caller
 	w.WriteHeader(errCode)
-	w.Write([]byte(err.Error()))
+	w.Write([]byte(message))
 	w.Header().Set("Content-Type", "text") // return error message as text
 	println(errCode)
-	println(err.Error()) // display the error message on the console
+	println(message) // display the error message on the console
 }
 
 func STTHandler() {
@@ -191,6 +291,11 @@ func STTHandler() {
 	//	3003 / tts
 }
 
+// go run stt.go sttlanguage.go sttoffline.go sttoptions.go sttpronunciation.go sttrecognizer.go sttsegment.go sttvocab.go config.go secrets.go speechauth.go speechregion.go wav.go
 func main() {
+	MustCheckLanguages()
+	MustCheckDefaultOptions()
+	recognizer = NewRecognizer(EnvString("STT_BACKEND", "azure"))
+	vocabulary = MustLoadVocabulary(vocabularyFile)
 	STTHandler()
 }
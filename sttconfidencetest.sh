@@ -0,0 +1,31 @@
+#!/bin/sh
+# Checks recognitions below the confidence threshold are reported as uncertain, start the stand-in and
+# stt with a threshold first:
+#   go run azurestub.go
+#   STT_CONFIDENCE_THRESHOLD=0.6 STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run stt.go ...
+FAILED=0
+
+check() { # check <description> <wav file> <expected status> <expected text in response>
+	echo "{\"speech\":\"`base64 -i $2 | tr -d "\n"`\"}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3002/stt`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+# a second of quiet audio, which the stand-in is only 0.41 sure of
+{ head -c 44 speech.wav; head -c 32000 /dev/zero | tr '\0' '\1'; } > quiet.wav
+
+check "clear speech" speech.wav 200 '"status":"success"'
+check "confidence of the best alternative" speech.wav 200 '"confidence":0.93'
+check "quiet speech is uncertain" quiet.wav 422 '"status":"uncertain"'
+check "uncertain recognitions keep their text" quiet.wav 422 '"text":"\*\*\*\* what is the melting point of silver?"'
+check "confidence below the threshold" quiet.wav 422 '"confidence":0.41'
+check "alternatives of uncertain recognitions" quiet.wav 422 '"nbest":\[{"confidence":0.41'
+
+rm -f input output quiet.wav
+exit $FAILED
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const AUTO_LANGUAGE = "auto" // request value asking the service to pick the language itself
+
+var (
+	defaultLanguage  = EnvString("STT_LANGUAGE", "en-US")
+	allowedLanguages = EnvList("STT_LANGUAGES", []string{"en-US", "en-GB", "cy-GB", "de-DE"})
+	autoLanguages    = EnvList("STT_AUTO_LANGUAGES", []string{"en-US", "en-GB", "cy-GB", "de-DE"}) // tried in order of preference
+)
+
+// MustCheckLanguages exits at startup if the default or automatic languages aren't allowed, and makes
+// the default the first candidate for automatic detection, so it wins when the candidates tie.
+func MustCheckLanguages() {
+	language, err, _ := CheckLanguage(defaultLanguage)
+	if err != nil || language == AUTO_LANGUAGE {
+		println("Invalid STT_LANGUAGE '" + defaultLanguage + "' - Choose one of " + strings.Join(allowedLanguages, ", "))
+		os.Exit(1)
+	}
+	defaultLanguage = language
+
+	candidates := []string{defaultLanguage}
+	for _, candidate := range autoLanguages {
+		language, err, _ := CheckLanguage(candidate)
+		if err != nil || language == AUTO_LANGUAGE {
+			println("Invalid STT_AUTO_LANGUAGES entry '" + candidate + "' - Choose from " + strings.Join(allowedLanguages, ", "))
+			os.Exit(1)
+		}
+		if !Contains(candidates, language) {
+			candidates = append(candidates, language)
+		}
+	}
+	autoLanguages = candidates
+}
+
+func CheckLanguage(language string) (string, error, int) {
+	if language == "" {
+		return defaultLanguage, nil, 0
+	}
+
+	if strings.EqualFold(language, AUTO_LANGUAGE) {
+		return AUTO_LANGUAGE, nil, 0
+	}
+
+	for _, allowed := range allowedLanguages {
+		if strings.EqualFold(language, allowed) {
+			return allowed, nil, 0 // use the configured spelling, microsoft expects e.g. en-US
+		}
+	}
+
+	err := errors.New("The language '" + language + "' is not supported - Choose one of " +
+		strings.Join(allowedLanguages, ", ") + " or '" + AUTO_LANGUAGE + "'")
+	return "", err, http.StatusBadRequest
+}
+
+// DetectLanguage recognises the speech once per candidate language and keeps the language whose
+// recognition was most confident. The winning response is returned so it needn't be requested again.
+func DetectLanguage(decodedSpeech []byte, options recognitionOptions) (string, []byte, string, error, int) {
+	if _, offline := recognizer.(offlineRecognizer); offline { // engines that give no confidence would always pick the first
+		err := errors.New("Automatic language detection is not supported by the offline speech-to-text backend - Choose a language")
+		return "", nil, "local", err, http.StatusNotImplemented
+	}
+	if len(autoLanguages) == 0 {
+		return "", nil, "", errors.New("No candidate languages are configured for automatic detection!"), http.StatusInternalServerError
+	}
+
+	responses := make([][]byte, len(autoLanguages))
+	regions := make([]string, len(autoLanguages))
+	errs := make([]error, len(autoLanguages))
+	errCodes := make([]int, len(autoLanguages))
+
+	var wg sync.WaitGroup
+	for i, language := range autoLanguages {
+		options.Language = language
+		wg.Add(1)
+		go func(i int, options recognitionOptions) {
+			defer wg.Done()
+			responses[i], regions[i], errs[i], errCodes[i] = recognizer.Recognize(decodedSpeech, options)
+		}(i, options)
+	}
+	wg.Wait()
+
+	best, bestScore := -1, -1.0
+	for i := range autoLanguages {
+		if errs[i] != nil {
+			continue
+		}
+		if score := RecognitionScore(responses[i]); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best < 0 { // every candidate failed to reach microsoft
+		return "", nil, regions[0], errs[0], errCodes[0]
+	}
+
+	println("Detected language " + autoLanguages[best])
+
+	return autoLanguages[best], responses[best], regions[best], nil, 0
+}
+
+// RecognitionScore ranks a recognition response, failed recognitions score zero and successful
+// ones score the confidence of their best alternative.
+func RecognitionScore(responseText []byte) float64 {
+	result := &recognitionResult{}
+	if json.Unmarshal(responseText, result) != nil || result.RecognitionStatus != "Success" {
+		return 0
+	}
+	return 1 + result.Confidence() // a success always outranks a failure
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The offline engine is any command line recogniser that prints the transcript of a wav file, either
+// as plain text or as json with a "text" field, e.g. for whisper.cpp
+// STT_OFFLINE_COMMAND="whisper-cli -m /models/ggml-base.bin -l {lang} -nt -np -f {file}"
+// {file} is replaced by the recording, {language} by the language code and {lang} by its first part.
+// Requests must name their language, as automatic detection compares the confidence of each candidate.
+
+var (
+	offlineCommand = EnvString("STT_OFFLINE_COMMAND", "")
+	offlineTimeout = EnvDuration("STT_OFFLINE_TIMEOUT", 2*time.Minute)
+	nonLexical     = regexp.MustCompile(`[^\p{L}\p{N}' ]+`)
+)
+
+type offlineRecognizer struct {
+	command []string
+	timeout time.Duration
+}
+
+func NewOfflineRecognizer() SpeechRecognizer {
+	if offlineCommand == "" {
+		println("No STT_OFFLINE_COMMAND configured for the offline backend, e.g. whisper-cli -m model.bin -l {lang} -nt -np -f {file}")
+		os.Exit(1)
+	}
+	return offlineRecognizer{command: strings.Fields(offlineCommand), timeout: offlineTimeout}
+}
+
+func (offline offlineRecognizer) Recognize(decodedSpeech []byte, options recognitionOptions) ([]byte, string, error, int) {
+	if options.Assessment != nil {
+		err := errors.New("Pronunciation assessment is not supported by the offline speech-to-text backend")
+		return nil, "local", err, http.StatusNotImplemented
+	}
+
+	speechFile, err := ioutil.TempFile("", "stt-*.wav")
+	if err != nil {
+		return nil, "local", err, http.StatusInternalServerError
+	}
+	defer os.Remove(speechFile.Name())
+
+	_, err = speechFile.Write(decodedSpeech)
+	speechFile.Close()
+	if err != nil {
+		return nil, "local", err, http.StatusInternalServerError
+	}
+
+	lang := strings.SplitN(options.Language, "-", 2)[0]
+	args := make([]string, len(offline.command))
+	for i, arg := range offline.command {
+		arg = strings.ReplaceAll(arg, "{file}", speechFile.Name())
+		arg = strings.ReplaceAll(arg, "{language}", options.Language)
+		args[i] = strings.ReplaceAll(arg, "{lang}", lang)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), offline.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	engine := exec.CommandContext(ctx, args[0], args[1:]...)
+	engine.Stdout, engine.Stderr = &stdout, &stderr
+	if err = engine.Run(); err != nil {
+		err = errors.New("The offline speech-to-text engine failed: " + err.Error() + " " + strings.TrimSpace(stderr.String()))
+		return nil, "local", err, http.StatusInternalServerError
+	}
+
+	responseText, err := OfflineResponse(stdout.Bytes(), decodedSpeech)
+	if err != nil {
+		return nil, "local", err, http.StatusInternalServerError
+	}
+
+	println(string(responseText))
+
+	return responseText, "local", nil, 0
+}
+
+// OfflineResponse converts the engine output into microsoft's detailed output format.
+func OfflineResponse(output []byte, decodedSpeech []byte) ([]byte, error) {
+	t := struct {
+		Text       string
+		Confidence *float64
+	}{}
+	if json.Unmarshal(output, &t) != nil {
+		t.Text = string(output) // plain text output
+	}
+	displayText := strings.Join(strings.Fields(t.Text), " ") // engines print one line per utterance
+
+	confidence := 1.0 // engines that give no confidence are trusted, so they are never reported uncertain
+	if t.Confidence != nil {
+		confidence = *t.Confidence
+	}
+
+	duration := int64(0)
+	if wav, err := ParseWAV(decodedSpeech); err == nil {
+		duration = int64(wav.Duration() / 100)
+	}
+
+	if displayText == "" {
+		return json.Marshal(map[string]interface{}{"RecognitionStatus": "NoMatch", "Offset": 0, "Duration": duration})
+	}
+
+	lexical := strings.ToLower(strings.Join(strings.Fields(nonLexical.ReplaceAllString(displayText, " ")), " "))
+	return json.Marshal(map[string]interface{}{
+		"RecognitionStatus": "Success",
+		"Offset":            0,
+		"Duration":          duration,
+		"DisplayText":       displayText,
+		"NBest": []map[string]interface{}{{
+			"Confidence": confidence,
+			"Lexical":    lexical,
+			"ITN":        lexical,
+			"MaskedITN":  lexical,
+			"Display":    displayText,
+		}},
+	})
+}
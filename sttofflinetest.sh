@@ -0,0 +1,26 @@
+#!/bin/sh
+# Checks the offline backend with echo standing in for the recogniser, start stt with it first:
+#   STT_BACKEND=offline STT_OFFLINE_COMMAND="echo {lang}: what is the melting point of silver" go run stt.go ...
+SPEECH=`base64 -i speech.wav | tr -d "\n"`
+FAILED=0
+
+check() { # check <description> <extra json fields> <expected status> <expected text in response>
+	echo "{\"speech\":\"$SPEECH\"$2}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3002/stt`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+check "transcript of the engine" "" 200 '"text":"en: what is the melting point of silver"'
+check "recognised locally" "" 200 '"region":"local"'
+check "engines without a confidence are trusted" "" 200 '"confidence":1'
+check "language passed to the engine" ",\"language\":\"de-DE\"" 200 '"text":"de: what is'
+check "no automatic detection" ",\"language\":\"auto\"" 501 "not supported by the offline speech-to-text backend - Choose a language"
+check "no pronunciation assessment" ",\"referenceText\":\"Hello\"" 501 "not supported by the offline"
+
+rm -f input output
+exit $FAILED
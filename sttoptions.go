@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	defaultProfanity      = EnvString("STT_PROFANITY", "masked")
+	defaultEndpointID     = EnvString("STT_ENDPOINT_ID", "") // custom speech model, empty for the base model
+	defaultWordTimestamps = EnvBool("STT_WORD_TIMESTAMPS", false)
+)
+
+var (
+	profanityModes    = []string{"masked", "removed", "raw"}
+	endpointIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+type recognitionOptions struct {
+	Language       string                   // a supported language code or AUTO_LANGUAGE
+	Profanity      string                   // masked, removed or raw
+	EndpointID     string                   // deployment id of a custom speech model
+	WordTimestamps bool                     // include the offset and duration of every recognised word
+	Assessment     *pronunciationAssessment // score the speech against a reference text, nil to skip
+}
+
+// MustCheckDefaultOptions exits at startup rather than failing every request with a mistyped
+// STT_PROFANITY or STT_ENDPOINT_ID.
+func MustCheckDefaultOptions() {
+	options := recognitionOptions{Profanity: defaultProfanity, EndpointID: defaultEndpointID}
+	if err, _ := CheckOptions(&options); err != nil {
+		println("Invalid STT_PROFANITY or STT_ENDPOINT_ID - " + err.Error())
+		os.Exit(1)
+	}
+	defaultProfanity = options.Profanity
+}
+
+// RecognitionOptions reads the optional recognition fields of a /stt request, using the deployment
+// defaults for any that are absent.
+func RecognitionOptions(t map[string]interface{}) (recognitionOptions, error, int) {
+	options := recognitionOptions{
+		Profanity:      defaultProfanity,
+		EndpointID:     defaultEndpointID,
+		WordTimestamps: defaultWordTimestamps,
+	}
+
+	requestLanguage, ok := t["language"].(string)
+	if _, present := t["language"]; present && !ok {
+		return options, errors.New("Field 'language' must be a string"), http.StatusBadRequest
+	}
+	language, err, errCode := CheckLanguage(requestLanguage)
+	if err != nil {
+		return options, err, errCode
+	}
+	options.Language = language
+
+	if profanity, present := t["profanity"]; present {
+		if options.Profanity, ok = profanity.(string); !ok {
+			return options, errors.New("Field 'profanity' must be a string"), http.StatusBadRequest
+		}
+	}
+	if endpointID, present := t["endpointId"]; present {
+		if options.EndpointID, ok = endpointID.(string); !ok {
+			return options, errors.New("Field 'endpointId' must be a string"), http.StatusBadRequest
+		}
+	}
+	if wordTimestamps, present := t["wordTimestamps"]; present {
+		if options.WordTimestamps, ok = wordTimestamps.(bool); !ok {
+			return options, errors.New("Field 'wordTimestamps' must be true or false"), http.StatusBadRequest
+		}
+	}
+
+	options.Assessment, err, errCode = AssessmentOptions(t)
+	if err != nil {
+		return options, err, errCode
+	}
+
+	err, errCode = CheckOptions(&options)
+	return options, err, errCode
+}
+
+func CheckOptions(options *recognitionOptions) (error, int) {
+	profanity := strings.ToLower(options.Profanity)
+	if !Contains(profanityModes, profanity) {
+		return errors.New("The profanity mode '" + options.Profanity + "' is not supported - Choose one of " +
+			strings.Join(profanityModes, ", ")), http.StatusBadRequest
+	}
+	options.Profanity = profanity
+
+	if options.EndpointID != "" && !endpointIDPattern.MatchString(options.EndpointID) {
+		return errors.New("The endpoint id '" + options.EndpointID + "' is not a valid custom speech deployment id"),
+			http.StatusBadRequest
+	}
+
+	return nil, 0
+}
@@ -0,0 +1,46 @@
+#!/bin/sh
+# Checks the recognition options against the local stand-in, start both services first:
+#   go run azurestub.go
+#   STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run stt.go ...
+SPEECH=`base64 -i speech.wav | tr -d "\n"`
+FAILED=0
+
+check() { # check <description> <extra json fields> <expected status> <expected text in response>
+	echo "{\"speech\":\"$SPEECH\"$2}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3002/stt`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `cat output`"
+		FAILED=1
+	fi
+}
+
+check "default profanity is masked" "" 200 '"text":"\*\*\*\* what is'
+check "raw profanity" ",\"profanity\":\"raw\"" 200 '"text":"Damn what is'
+check "removed profanity" ",\"profanity\":\"removed\"" 200 '"text":"What is'
+check "unknown profanity mode" ",\"profanity\":\"bleeped\"" 400 "not supported"
+check "custom endpoint id" ",\"endpointId\":\"0b3c6e6a-1f7e-4a44-9b7d-3f5c2f1d9e21\"" 200 "sterling silver"
+check "malformed endpoint id" ",\"endpointId\":\"my-model\"" 400 "not a valid custom speech deployment id"
+check "word timestamps" ",\"wordTimestamps\":true" 200 '"words":\[{"word":"damn","offset":1000000'
+check "no word timestamps by default" "" 200 '"confidence"'
+check "word timestamps must be a boolean" ",\"wordTimestamps\":\"yes\"" 400 "must be true or false"
+check "pronunciation assessment" ",\"referenceText\":\"What is the melting point of gold?\"" 200 '"pronunciation":{"accuracy":'
+check "mispronounced word" ",\"referenceText\":\"What is the melting point of gold?\"" 200 '"word":"silver","accuracy":60,"errorType":"Mispronunciation"'
+check "empty reference text" ",\"referenceText\":\"\"" 400 "non-empty string"
+check "assessment needs a language" ",\"referenceText\":\"Hello\",\"language\":\"auto\"" 400 "needs the language"
+check "unknown grading system" ",\"referenceText\":\"Hello\",\"gradingSystem\":\"Percent\"" 400 "must be one of"
+
+check "default language" "" 200 '"language":"en-US"'
+check "requested language" ",\"language\":\"de-DE\"" 200 '"language":"de-DE"'
+check "configured spelling of the language" ",\"language\":\"CY-gb\"" 200 '"language":"cy-GB"'
+check "unsupported language" ",\"language\":\"fr-FR\"" 400 "is not supported - Choose one of"
+check "language must be a string" ",\"language\":7" 400 "Field 'language' must be a string"
+check "detected language" ",\"language\":\"auto\"" 200 '"language":"en-US"' # the stand-in is equally sure of every language, so the default wins
+
+curl -s -X POST localhost:3010/stub/revoke # the cached token is now rejected
+check "fresh token after a 401" "" 200 '"status":"success"'
+
+rm -f input output
+exit $FAILED
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	gradingSystems = []string{"HundredMark", "FivePoint"}
+	granularities  = []string{"Phoneme", "Word", "FullText"}
+)
+
+// pronunciationAssessment is sent to microsoft, base64 encoded, in the Pronunciation-Assessment header.
+type pronunciationAssessment struct {
+	ReferenceText string // the sentence the speaker was asked to read
+	GradingSystem string
+	Granularity   string
+	Dimension     string
+	EnableMiscue  bool // mark omitted and inserted words against the reference text
+}
+
+type pronunciationScores struct {
+	Accuracy      float64     `json:"accuracy"`
+	Fluency       float64     `json:"fluency"`
+	Completeness  float64     `json:"completeness"`
+	Pronunciation float64     `json:"pronunciation"` // overall score combining the other three
+	Words         []wordScore `json:"words"`
+}
+
+type wordScore struct {
+	Word      string  `json:"word"`
+	Accuracy  float64 `json:"accuracy"`
+	ErrorType string  `json:"errorType"` // None, Omission, Insertion or Mispronunciation
+}
+
+// AssessmentOptions reads the pronunciation assessment fields of a /stt request, returning nil
+// when no reference text was given.
+func AssessmentOptions(t map[string]interface{}) (*pronunciationAssessment, error, int) {
+	referenceText, present := t["referenceText"]
+	if !present {
+		return nil, nil, 0
+	}
+
+	assessment := &pronunciationAssessment{
+		GradingSystem: "HundredMark",
+		Granularity:   "Word",
+		Dimension:     "Comprehensive", // include fluency and completeness as well as accuracy
+		EnableMiscue:  true,
+	}
+
+	var ok bool
+	if assessment.ReferenceText, ok = referenceText.(string); !ok || strings.TrimSpace(assessment.ReferenceText) == "" {
+		return nil, errors.New("Field 'referenceText' must be a non-empty string"), http.StatusBadRequest
+	}
+	if gradingSystem, present := t["gradingSystem"]; present {
+		if assessment.GradingSystem, ok = gradingSystem.(string); !ok || !Contains(gradingSystems, assessment.GradingSystem) {
+			return nil, errors.New("Field 'gradingSystem' must be one of " + strings.Join(gradingSystems, ", ")), http.StatusBadRequest
+		}
+	}
+	if granularity, present := t["granularity"]; present {
+		if assessment.Granularity, ok = granularity.(string); !ok || !Contains(granularities, assessment.Granularity) {
+			return nil, errors.New("Field 'granularity' must be one of " + strings.Join(granularities, ", ")), http.StatusBadRequest
+		}
+	}
+	if enableMiscue, present := t["enableMiscue"]; present {
+		if assessment.EnableMiscue, ok = enableMiscue.(bool); !ok {
+			return nil, errors.New("Field 'enableMiscue' must be true or false"), http.StatusBadRequest
+		}
+	}
+
+	return assessment, nil, 0
+}
+
+func AssessmentHeader(assessment *pronunciationAssessment) (string, error) {
+	assessmentJSON, err := json.Marshal(assessment)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(assessmentJSON), nil
+}
+
+// AssessPronunciation recognises the speech with the assessment header set and scores it against the reference text.
+func AssessPronunciation(sttReq *sttRequest) (*recognitionResult, error, int) {
+	if sttReq.Language == AUTO_LANGUAGE {
+		err := errors.New("Pronunciation assessment needs the language of the reference text, not '" + AUTO_LANGUAGE + "'")
+		return nil, err, http.StatusBadRequest
+	}
+
+	segments, err, errCode := SegmentSpeech(sttReq.Speech)
+	if err != nil {
+		return nil, err, errCode
+	}
+	if len(segments) > 1 { // the reference text can't be split along with the audio
+		err = errors.New("Pronunciation assessment is limited to recordings of " + SEGMENT_MAX.String() + " or less")
+		return nil, err, http.StatusBadRequest
+	}
+
+	responseText, region, err, errCode := recognizer.Recognize(sttReq.Speech, sttReq.recognitionOptions)
+	if err != nil {
+		return nil, err, errCode
+	}
+
+	result, err, errCode := CheckResponse(responseText)
+	if err != nil {
+		return nil, err, errCode
+	}
+	result.Region = region
+
+	result.Pronunciation, err, errCode = CheckAssessment(responseText)
+	if err != nil {
+		return nil, err, errCode
+	}
+
+	return result, nil, 0
+}
+
+func CheckAssessment(responseText []byte) (*pronunciationScores, error, int) {
+	// microsoft reports the scores directly on each alternative and word, or nested under
+	// PronunciationAssessment depending on the api version, so both layouts are read
+	type scores struct {
+		AccuracyScore     float64
+		FluencyScore      float64
+		CompletenessScore float64
+		PronScore         float64
+		ErrorType         string
+	}
+	t := struct {
+		NBest []struct {
+			scores
+			PronunciationAssessment *scores
+			Words                   []struct {
+				Word string
+				scores
+				PronunciationAssessment *scores
+			}
+		}
+	}{}
+
+	err := json.Unmarshal(responseText, &t)
+	if err != nil {
+		return nil, err, http.StatusInternalServerError // could not decode json response due to perceived client error
+	}
+	if len(t.NBest) == 0 {
+		err = errors.New("Object contains no field 'NBest'") // handle error for incorrect json object
+		return nil, err, http.StatusInternalServerError
+	}
+
+	best := t.NBest[0]
+	overall := best.scores
+	if best.PronunciationAssessment != nil {
+		overall = *best.PronunciationAssessment
+	}
+
+	assessed := &pronunciationScores{
+		Accuracy:      overall.AccuracyScore,
+		Fluency:       overall.FluencyScore,
+		Completeness:  overall.CompletenessScore,
+		Pronunciation: overall.PronScore,
+		Words:         []wordScore{},
+	}
+	for _, word := range best.Words {
+		wordScores := word.scores
+		if word.PronunciationAssessment != nil {
+			wordScores = *word.PronunciationAssessment
+		}
+		if wordScores.ErrorType == "" {
+			wordScores.ErrorType = "None"
+		}
+		assessed.Words = append(assessed.Words, wordScore{Word: word.Word, Accuracy: wordScores.AccuracyScore, ErrorType: wordScores.ErrorType})
+	}
+
+	println("Pronunciation score", int(assessed.Pronunciation))
+
+	return assessed, nil, 0
+}
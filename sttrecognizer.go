@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+)
+
+// SpeechRecognizer turns a wav recording into a recognition response in microsoft's detailed output
+// format, so every backend is checked and reported the same way. It also returns where the speech
+// was recognised, such as the azure region.
+type SpeechRecognizer interface {
+	Recognize(decodedSpeech []byte, options recognitionOptions) ([]byte, string, error, int)
+}
+
+var recognizer SpeechRecognizer // chosen by main
+
+// NewRecognizer picks the backend named by STT_BACKEND, exiting if it can't be set up.
+func NewRecognizer(backend string) SpeechRecognizer {
+	switch backend {
+	case "azure":
+		speechKey = MustLoadSecret("SPEECH_KEY") // fail fast rather than on the first request
+		return azureRecognizer{}
+	case "offline":
+		return NewOfflineRecognizer()
+	}
+
+	println("Unknown STT_BACKEND '" + backend + "' - Choose azure or offline")
+	os.Exit(1)
+	return nil
+}
+
+// azureRecognizer uses the microsoft speech-to-text short audio api.
+type azureRecognizer struct{}
+
+func (azureRecognizer) Recognize(decodedSpeech []byte, options recognitionOptions) ([]byte, string, error, int) {
+	return SpeechToText(decodedSpeech, options)
+}
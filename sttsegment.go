@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SEGMENT_MAX     = 55 * time.Second       // the short audio endpoint rejects clips longer than 60 seconds
+	SEGMENT_MIN     = 20 * time.Second       // never cut a segment shorter than this while searching for silence
+	SEGMENT_FRAME   = 20 * time.Millisecond  // window used to measure the loudness of the audio
+	SEGMENT_SMOOTH  = 100 * time.Millisecond // a cut must sit in a quiet stretch, not a short dip between syllables
+	SEGMENT_WORKERS = 4                      // maximum number of segments sent to microsoft at once
+)
+
+type speechSegment struct {
+	Index    int
+	Offset   time.Duration // position of the segment within the original recording
+	Speech   []byte
+	Response []byte // recognition already obtained while detecting the language, if any
+	Region   string // the region that produced Response
+}
+
+func TranscribeSpeech(sttReq *sttRequest) (*recognitionResult, string, error, int) {
+	segments, err, errCode := SegmentSpeech(sttReq.Speech)
+	if err != nil {
+		return nil, "", err, errCode
+	}
+
+	options := sttReq.recognitionOptions
+	if options.Language == AUTO_LANGUAGE { // the first segment is enough to tell which language is spoken
+		options.Language, segments[0].Response, segments[0].Region, err, errCode = DetectLanguage(segments[0].Speech, options)
+		if err != nil {
+			return nil, "", err, errCode
+		}
+	}
+
+	if len(segments) == 1 { // short enough for a single request
+		responseText, region := segments[0].Response, segments[0].Region
+		if responseText == nil {
+			responseText, region, err, errCode = recognizer.Recognize(segments[0].Speech, options)
+			if err != nil {
+				return nil, "", err, errCode
+			}
+		}
+		result, err, errCode := CheckResponse(responseText)
+		if err != nil {
+			return nil, "", err, errCode
+		}
+		result.Region = region
+		return result, options.Language, nil, 0
+	}
+
+	segmentResults := make([]*recognitionResult, len(segments))
+	segmentErrs := make([]error, len(segments))
+	segmentErrCodes := make([]int, len(segments))
+
+	workers := make(chan struct{}, SEGMENT_WORKERS) // bounds the number of concurrent requests
+	var wg sync.WaitGroup
+	for i := range segments {
+		wg.Add(1)
+		go func(segment speechSegment) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			segmentResults[segment.Index], segmentErrs[segment.Index], segmentErrCodes[segment.Index] = TranscribeSegment(segment, options)
+		}(segments[i])
+	}
+	wg.Wait()
+
+	spokenResults := []*recognitionResult{}
+	for i, segment := range segments { // report the earliest failure so the offset points at the first bad part of the recording
+		if segmentErrs[i] != nil {
+			err = fmt.Errorf("Segment %d of %d (offset %s) could not be transcribed: %v",
+				segment.Index+1, len(segments), segment.Offset, segmentErrs[i])
+			return nil, "", err, segmentErrCodes[i]
+		}
+		if segmentResults[i] != nil {
+			spokenResults = append(spokenResults, segmentResults[i])
+		}
+	}
+
+	if len(spokenResults) == 0 { // every segment was silent
+		return nil, "", RecognitionErr("InitialSilenceTimeout"), http.StatusInternalServerError
+	}
+
+	result := MergeResults(spokenResults)
+
+	println(result.DisplayText)
+
+	return result, options.Language, nil, 0
+}
+
+// MergeResults stitches the segment recognitions back into one, in order. The best alternatives of
+// each segment are joined and their confidence is weighted by how much speech each one covered.
+func MergeResults(results []*recognitionResult) *recognitionResult {
+	merged := &recognitionResult{RecognitionStatus: "Success", Offset: results[0].Offset}
+	best := recognitionAlternative{}
+	displayText, lexical, itn, maskedITN, display := []string{}, []string{}, []string{}, []string{}, []string{}
+	regions := []string{}
+	weightedConfidence, totalDuration := 0.0, int64(0)
+
+	for _, result := range results {
+		displayText = append(displayText, result.DisplayText)
+		if !Contains(regions, result.Region) { // segments may have been failed over to different regions
+			regions = append(regions, result.Region)
+		}
+		alternative := result.NBest[0]
+		lexical = append(lexical, alternative.Lexical)
+		itn = append(itn, alternative.ITN)
+		maskedITN = append(maskedITN, alternative.MaskedITN)
+		display = append(display, alternative.Display)
+		best.Words = append(best.Words, alternative.Words...)
+
+		weight := result.Duration
+		if weight <= 0 {
+			weight = 1 // still count segments microsoft didn't time
+		}
+		weightedConfidence += alternative.Confidence * float64(weight)
+		totalDuration += weight
+		merged.Duration += result.Duration
+	}
+
+	merged.DisplayText = strings.Join(displayText, " ")
+	merged.Region = strings.Join(regions, ",")
+	best.Lexical = strings.Join(lexical, " ")
+	best.ITN = strings.Join(itn, " ")
+	best.MaskedITN = strings.Join(maskedITN, " ")
+	best.Display = strings.Join(display, " ")
+	best.Confidence = weightedConfidence / float64(totalDuration)
+	merged.NBest = []recognitionAlternative{best}
+
+	return merged
+}
+
+func TranscribeSegment(segment speechSegment, options recognitionOptions) (*recognitionResult, error, int) {
+	responseText, region := segment.Response, segment.Region
+	if responseText == nil {
+		var err error
+		var errCode int
+		responseText, region, err, errCode = recognizer.Recognize(segment.Speech, options)
+		if err != nil {
+			return nil, err, errCode
+		}
+	}
+
+	if SilentSegment(responseText) { // a pause between sentences can fill a whole segment
+		return nil, nil, 0
+	}
+
+	result, err, errCode := CheckResponse(responseText)
+	if err != nil {
+		return nil, err, errCode
+	}
+	result.Region = region
+
+	// microsoft times everything from the start of the segment, shift it to the start of the recording
+	segmentOffset := int64(segment.Offset / 100)
+	result.Offset += segmentOffset
+	for i := range result.NBest {
+		for j := range result.NBest[i].Words {
+			result.NBest[i].Words[j].Offset += segmentOffset
+		}
+	}
+
+	return result, nil, 0
+}
+
+func SilentSegment(responseText []byte) bool {
+	t := map[string]interface{}{}
+	if json.Unmarshal(responseText, &t) != nil {
+		return false // let CheckResponse report the malformed response
+	}
+	recStatus, _ := t["RecognitionStatus"].(string)
+	return recStatus == "InitialSilenceTimeout" || recStatus == "BabbleTimeout"
+}
+
+func SegmentSpeech(decodedSpeech []byte) ([]speechSegment, error, int) {
+	wav, err := ParseWAV(decodedSpeech)
+	if err != nil || wav.AudioFormat != 1 || wav.Duration() <= SEGMENT_MAX {
+		// short clips are sent untouched, and microsoft reports any problem with files we can't parse or
+		// compressed audio, whose length can't be told from its size
+		return []speechSegment{{Index: 0, Offset: 0, Speech: decodedSpeech}}, nil, 0
+	}
+
+	if wav.BitsPerSample != 16 {
+		err = errors.New("Audio longer than " + SEGMENT_MAX.String() + " must be 16-bit PCM so it can be split into segments!")
+		return nil, err, http.StatusBadRequest
+	}
+
+	frameLen := int(time.Duration(wav.SampleRate) * SEGMENT_FRAME / time.Second) // sample frames per loudness window
+	loudness := SmoothedLoudness(wav, frameLen)
+	maxWindows := int(SEGMENT_MAX / SEGMENT_FRAME)
+	minWindows := int(SEGMENT_MIN / SEGMENT_FRAME)
+
+	segments := []speechSegment{}
+	start := 0
+	for start < len(loudness) {
+		end := len(loudness)
+		if end-start > maxWindows {
+			end = QuietestWindow(loudness, start+minWindows, start+maxWindows)
+		}
+
+		startFrame, endFrame := start*frameLen, end*frameLen
+		if endFrame > wav.Frames() {
+			endFrame = wav.Frames()
+		}
+
+		segments = append(segments, speechSegment{
+			Index:  len(segments),
+			Offset: wav.FrameOffset(startFrame),
+			Speech: wav.Slice(startFrame, endFrame).Bytes(),
+		})
+		start = end
+	}
+
+	println(len(segments), "segments") // check how the recording was split
+
+	return segments, nil, 0
+}
+
+// SmoothedLoudness measures the RMS level of each window of the audio, averaged over its neighbours.
+func SmoothedLoudness(wav *WAV, frameLen int) []float64 {
+	blockAlign := wav.BlockAlign()
+	windows := (wav.Frames() + frameLen - 1) / frameLen
+	rms := make([]float64, windows)
+	for i := range rms {
+		start := i * frameLen * blockAlign
+		end := start + frameLen*blockAlign
+		if end > len(wav.Data) {
+			end = len(wav.Data)
+		}
+		sum, n := 0.0, 0
+		for pos := start; pos+1 < end; pos += 2 { // every channel contributes to the level
+			sample := float64(int16(binary.LittleEndian.Uint16(wav.Data[pos : pos+2])))
+			sum += sample * sample
+			n++
+		}
+		if n > 0 {
+			rms[i] = math.Sqrt(sum / float64(n))
+		}
+	}
+
+	radius := int(SEGMENT_SMOOTH/SEGMENT_FRAME) / 2
+	smoothed := make([]float64, windows)
+	for i := range smoothed {
+		sum, n := 0.0, 0
+		for j := i - radius; j <= i+radius; j++ {
+			if j >= 0 && j < windows {
+				sum += rms[j]
+				n++
+			}
+		}
+		smoothed[i] = sum / float64(n)
+	}
+
+	return smoothed
+}
+
+// QuietestWindow picks the cut point in [from, to), preferring the latest of equally quiet windows
+// so segments stay as long as possible.
+func QuietestWindow(loudness []float64, from, to int) int {
+	if to > len(loudness) {
+		to = len(loudness)
+	}
+	quietest := from
+	for i := from; i < to; i++ {
+		if loudness[i] <= loudness[quietest] {
+			quietest = i
+		}
+	}
+	return quietest
+}
@@ -0,0 +1,55 @@
+#!/bin/sh
+# Checks long recordings are split into segments and their recognitions stitched back together, start
+# the stand-in and stt first:
+#   go run azurestub.go
+#   STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run stt.go ...
+FAILED=0
+
+le() { # le <bytes> <number> writes the number little endian
+	n=$2
+	for i in `seq $1`; do
+		printf "\\`printf %03o $((n % 256))`"
+		n=$((n / 256))
+	done
+}
+
+long_wav() { # long_wav <format> <bits per sample> <copies of speech.wav> writes long.wav
+	tail -c +45 speech.wav > samples
+	: > data
+	for i in `seq $3`; do cat samples >> data; done
+	SIZE=`wc -c < data`
+	{
+		printf RIFF; le 4 $((36 + SIZE)); printf WAVEfmt; printf " "; le 4 16
+		le 2 $1; le 2 1; le 4 16000; le 4 $((16000 * $2 / 8)); le 2 $(($2 / 8 + ($2 < 8))); le 2 $2
+		printf data; le 4 $SIZE; cat data
+	} > long.wav
+	rm -f samples data
+}
+
+check() { # check <description> <extra json fields> <expected status> <expected text in response>
+	echo "{\"speech\":\"`base64 -i long.wav | tr -d "\n"`\"$2}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3002/stt`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+long_wav 1 16 37 # 70 seconds of 16-bit pcm, longer than the 55 second segments
+check "segments joined in order" "" 200 '"text":"\*\*\*\* what is the melting point of silver? \*\*\*\* what is the melting point of silver?"'
+check "confidence of the segments" "" 200 '"confidence":0.93'
+check "first segment timed from the start" ",\"wordTimestamps\":true" 200 '"words":\[{"word":"damn","offset":1000000,'
+# the second segment starts at least SEGMENT_MIN (20s) in, so its words are over 200000000 ticks from the start
+check "later segments offset" ",\"wordTimestamps\":true" 200 '{"word":"damn","offset":[2-5][0-9]\{8\},'
+
+long_wav 1 8 19 # 70 seconds of 8-bit pcm
+check "long audio must be 16-bit" "" 400 "must be 16-bit PCM so it can be split"
+
+long_wav 17 4 19 # ima adpcm, whose length can't be told from its size
+check "compressed audio sent whole" "" 200 '"status":"success"'
+
+rm -f input output long.wav
+exit $FAILED
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The vocabulary file lists the product and team names that recognition tends to mishear, one per
+// line, optionally followed by the ways it has been misheard:
+//
+//	# comment
+//	Wolfram Alpha
+//	Kubernetes = cooper netties, cuban eighties
+//
+// Misheard forms are replaced wherever they appear. Otherwise runs of words that sound like an
+// entry, by comparing their soundex codes, and are spelt similarly enough are replaced by it.
+
+var (
+	vocabularyFile     = EnvString("STT_VOCABULARY", "") // no correction when unset
+	vocabSimilarity    = EnvFloat("STT_VOCAB_SIMILARITY", 0.6)
+	vocabWord          = regexp.MustCompile(`[\p{L}\p{N}']+`)
+	vocabMinFuzzyChars = 4 // shorter entries only match their misheard forms, or every "the" would be a candidate
+)
+
+type vocabEntry struct {
+	Phrase   string
+	Words    int
+	Letters  string   // the phrase lowercased without spaces or punctuation
+	Soundex  string   // soundex of Letters
+	Misheard []string // lowercased, single spaced
+}
+
+type vocabCorrection struct {
+	Original  string `json:"original"`
+	Corrected string `json:"corrected"`
+	Match     string `json:"match"` // misheard or phonetic
+}
+
+type vocabularyList struct {
+	entries []vocabEntry
+}
+
+var vocabulary *vocabularyList // loaded by main, nil when there is no vocabulary
+
+func MustLoadVocabulary(path string) *vocabularyList {
+	if path == "" {
+		return nil
+	}
+	list, err := LoadVocabulary(path)
+	if err != nil {
+		println("Could not load the vocabulary from " + path + " - " + err.Error())
+		os.Exit(1)
+	}
+	println("Loaded", len(list.entries), "vocabulary entries from "+path)
+	return list
+}
+
+func LoadVocabulary(path string) (*vocabularyList, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &vocabularyList{}
+	for number, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		phrase := strings.Join(strings.Fields(parts[0]), " ")
+		if phrase == "" {
+			return nil, errors.New("Line " + strconv.Itoa(number+1) + " has no phrase before '='")
+		}
+
+		entry := vocabEntry{Phrase: phrase, Words: len(vocabWord.FindAllString(phrase, -1)), Letters: Letters(phrase)}
+		entry.Soundex = Soundex(entry.Letters)
+		if len(parts) == 2 {
+			for _, misheard := range strings.Split(parts[1], ",") {
+				if misheard = strings.ToLower(strings.Join(vocabWord.FindAllString(misheard, -1), " ")); misheard != "" {
+					entry.Misheard = append(entry.Misheard, misheard)
+				}
+			}
+		}
+		list.entries = append(list.entries, entry)
+	}
+
+	// longer phrases first, so "Wolfram Alpha" wins over "Alpha"
+	sort.SliceStable(list.entries, func(i, j int) bool { return list.entries[i].Words > list.entries[j].Words })
+
+	return list, nil
+}
+
+// Correct replaces the misheard phrases in the text, returning the corrected text and each correction made.
+func (list *vocabularyList) Correct(text string) (string, []vocabCorrection) {
+	corrections := []vocabCorrection{}
+	if list == nil {
+		return text, corrections
+	}
+
+	words := vocabWord.FindAllStringIndex(text, -1)
+	replaced := make([]bool, len(words)) // a word is only corrected once
+	type replacement struct {
+		start, end int // byte range in text
+		phrase     string
+	}
+	replacements := []replacement{}
+
+	for _, entry := range list.entries {
+		// misheard forms have a known word count, phonetic matches may split or join words
+		maxWords := entry.Words + 1
+		for _, misheard := range entry.Misheard {
+			if n := len(strings.Fields(misheard)); n > maxWords {
+				maxWords = n
+			}
+		}
+
+		for i := 0; i < len(words); i++ {
+			longest := maxWords
+			if i+longest > len(words) { // fewer words are left at the end of the text
+				longest = len(words) - i
+			}
+			for n := longest; n >= 1; n-- {
+				if AnyReplaced(replaced[i : i+n]) {
+					continue
+				}
+
+				start, end := words[i][0], words[i+n-1][1]
+				original := text[start:end]
+				match := entry.Matches(original)
+				if match == "" {
+					continue
+				}
+
+				for j := i; j < i+n; j++ {
+					replaced[j] = true
+				}
+				replacements = append(replacements, replacement{start, end, entry.Phrase})
+				corrections = append(corrections, vocabCorrection{Original: original, Corrected: entry.Phrase, Match: match})
+				println("Vocabulary (" + match + "): '" + original + "' -> '" + entry.Phrase + "'")
+				i += n - 1
+				break
+			}
+		}
+	}
+
+	// apply from the end of the text so the earlier byte ranges stay valid
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	for _, r := range replacements {
+		text = text[:r.start] + r.phrase + text[r.end:]
+	}
+
+	return text, corrections
+}
+
+// Matches reports how the words match the entry, or "" when they don't. Words that are already
+// the phrase, ignoring case, are left alone.
+func (entry vocabEntry) Matches(original string) string {
+	normalised := strings.ToLower(strings.Join(vocabWord.FindAllString(original, -1), " "))
+	if normalised == strings.ToLower(entry.Phrase) {
+		return ""
+	}
+	if Contains(entry.Misheard, normalised) {
+		return "misheard"
+	}
+
+	letters := Letters(original)
+	if len(entry.Letters) < vocabMinFuzzyChars || len(letters) < vocabMinFuzzyChars {
+		return ""
+	}
+	if Soundex(letters) == entry.Soundex && Similarity(letters, entry.Letters) >= vocabSimilarity {
+		return "phonetic"
+	}
+	return ""
+}
+
+func AnyReplaced(replaced []bool) bool {
+	for _, r := range replaced {
+		if r {
+			return true
+		}
+	}
+	return false
+}
+
+// Letters lowercases the text and drops everything but letters and digits, so "Cooper Netties"
+// and "coopernetties" compare equal.
+func Letters(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Soundex codes the consonant sounds of a word. Unlike the usual soundex the first letter is coded
+// too, so "cubernetes" matches "kubernetes", and the code is not truncated to four characters, since
+// product names are often long and would otherwise collide on their first syllables.
+func Soundex(letters string) string {
+	codes := map[rune]byte{
+		'b': '1', 'f': '1', 'p': '1', 'v': '1',
+		'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+		'd': '3', 't': '3',
+		'l': '4',
+		'm': '5', 'n': '5',
+		'r': '6',
+	}
+
+	var code strings.Builder
+	var last byte
+	for i, r := range letters {
+		digit, consonant := codes[r]
+		switch {
+		case i == 0 && !consonant:
+			code.WriteRune(unicode.ToUpper(r))
+		case consonant && digit != last:
+			code.WriteByte(digit)
+			last = digit
+		case r == 'h' || r == 'w': // h and w don't separate consonants with the same code
+		default:
+			last = 0 // vowels do
+		}
+	}
+	return code.String()
+}
+
+// Similarity is one minus the edit distance between a and b relative to the longer of the two.
+func Similarity(a, b string) float64 {
+	ar, br := []rune(a), []rune(b)
+	longest := len(ar)
+	if len(br) > longest {
+		longest = len(br)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(br)])/float64(longest)
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,27 @@
+#!/bin/sh
+# Checks vocabulary correction against the local stand-in, start both services first:
+#   go run azurestub.go
+#   STT_VOCABULARY=sttvocabtest.txt STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run stt.go ...
+SPEECH=`base64 -i speech.wav | tr -d "\n"`
+FAILED=0
+
+check() { # check <description> <extra json fields> <expected status> <expected text in response>
+	echo "{\"speech\":\"$SPEECH\"$2}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3002/stt`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `cat output`"
+		FAILED=1
+	fi
+}
+
+check "corrected text" "" 200 '"text":"\*\*\*\* what is the Melting Pot of Sylver?"'
+check "original text kept" "" 200 '"originalText":"\*\*\*\* what is the melting point of silver?"'
+check "misheard form" "" 200 '{"original":"melting point","corrected":"Melting Pot","match":"misheard"}'
+check "phonetic match" "" 200 '{"original":"silver","corrected":"Sylver","match":"phonetic"}'
+check "assessments are not corrected" ",\"referenceText\":\"What is the melting point of silver?\"" 200 '"corrections":\[\]'
+
+rm -f input output
+exit $FAILED
@@ -9,112 +9,244 @@ import (
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 const (
-	REGION = "uksouth"
-	URI    = "https://" + REGION + ".tts.speech.microsoft.com/" +
+	URI = "https://{region}.tts.speech.microsoft.com/" +
 		"cognitiveservices/v1"
-	KEY = ""
+	SSML_NAMESPACE  = "http://www.w3.org/2001/10/synthesis"
+	MSTTS_NAMESPACE = "https://www.w3.org/2001/mstts" // microsoft's extensions such as express-as
 )
 
+// TTS_ENDPOINT overrides URI, e.g. http://localhost:3010/cognitiveservices/v1 for azurestub.go
+var ttsRegions = SpeechRegions(EnvString("TTS_ENDPOINT", URI))
+
 type speak struct {
 	Version string `xml:"version,attr"`
+	Xmlns   string `xml:"xmlns,attr"`
+	Mstts   string `xml:"xmlns:mstts,attr"`
 	Lang    string `xml:"xml:lang,attr"`
 	Voice   voice  `xml:"voice"`
 }
 
 type voice struct {
-	Voice string `xml:",chardata"`
-	Lang  string `xml:"xml:lang,attr"`
-	Name  string `xml:"name,attr"`
+	Lang      string     `xml:"xml:lang,attr"`
+	Name      string     `xml:"name,attr"`
+	ExpressAs *expressAs `xml:"mstts:express-as,omitempty"` // only when a style or role is chosen
+	Prosody   *prosody   `xml:"prosody,omitempty"`          // only when the rate, pitch or volume is changed
+	Content   string     `xml:",innerxml"`                  // escaped by FragmentsSSML, as it holds say-as elements
+}
+
+type expressAs struct {
+	Style       string   `xml:"style,attr,omitempty"`
+	StyleDegree string   `xml:"styledegree,attr,omitempty"`
+	Role        string   `xml:"role,attr,omitempty"`
+	Prosody     *prosody `xml:"prosody,omitempty"`
+	Content     string   `xml:",innerxml"`
+}
+
+type prosody struct {
+	Rate    string `xml:"rate,attr,omitempty"`
+	Pitch   string `xml:"pitch,attr,omitempty"`
+	Volume  string `xml:"volume,attr,omitempty"`
+	Content string `xml:",innerxml"`
+}
+
+type ttsRequest struct {
+	Text   string
+	SSML   string // the caller's own ssml, sent in place of the text
+	Format string // X-Microsoft-OutputFormat of the audio
+	voiceOptions
+	Processing *postProcessing // applied to the synthesised audio, nil to return it as it is
 }
 
 func ProcessTTS(w http.ResponseWriter, r *http.Request) {
-	answerText, err, errCode := ExtractText(r)
+	ttsReq, err, errCode := ExtractText(r)
 	if err != nil {
 		TTSErrResponse(w, err, errCode) // return an error response from the microservice
+		return
+	}
+
+	answerSpeech, region, err, errCode := SynthesizeRequest(ttsReq)
+	if err == nil {
+		answerSpeech, err, errCode = PostProcess(answerSpeech, ttsReq.Processing)
+	}
+	if err != nil {
+		TTSErrResponse(w, err, errCode) // return an error response from the microservice
+	} else {
+		TTSResponse(w, answerSpeech, region, ttsReq.Format) // success
+	}
+}
+
+// SynthesizeRequest speaks the request's ssml, or its text in one or more chunks.
+func SynthesizeRequest(ttsReq *ttsRequest) ([]byte, string, error, int) {
+	if ttsReq.SSML != "" {
+		return synthesizer.Synthesize([]byte(ttsReq.SSML), ttsReq.Format)
+	}
+
+	if chunks := SplitSentences(ttsReq.Text, chunkChars); len(chunks) > 1 {
+		return SynthesizeChunks(ttsReq, chunks)
+	}
+
+	textSSML, err, errCode := CreateSSML(ttsReq)
+	if err != nil {
+		return nil, "", err, errCode
 	}
+	return synthesizer.Synthesize(textSSML, ttsReq.Format)
+}
 
-	textSSML, err, errCode := CreateSSML(answerText)
+// PreviewSSML returns the ssml a /tts request would be synthesised from, without synthesising it.
+func PreviewSSML(w http.ResponseWriter, r *http.Request) {
+	ttsReq, err, errCode := ExtractText(r)
 	if err != nil {
 		TTSErrResponse(w, err, errCode) // return an error response from the microservice
+		return
 	}
 
-	answerSpeech, err, errCode := TextToSpeech(textSSML)
+	textSSML := []byte(ttsReq.SSML)
+	if ttsReq.SSML == "" {
+		textSSML, err, errCode = CreateSSML(ttsReq)
+	}
 	if err != nil {
 		TTSErrResponse(w, err, errCode) // return an error response from the microservice
-	} else {
-		TTSResponse(w, answerSpeech) // success
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/ssml+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(textSSML)
 }
 
-func ExtractText(r *http.Request) (string, error, int) {
+func ExtractText(r *http.Request) (*ttsRequest, error, int) {
 	t := map[string]interface{}{}
 	err := json.NewDecoder(r.Body).Decode(&t)
 	if err != nil {
-		return "", err, http.StatusBadRequest // could not decode json query due to perceived client error
+		return nil, err, http.StatusBadRequest // could not decode json query due to perceived client error
+	}
+
+	format, err, errCode := OutputFormat(t) // optional, TTS_FORMAT is used when absent
+	if err != nil {
+		return nil, err, errCode
+	}
+
+	processing, err, errCode := PostProcessing(t, format) // optional, the TTS_ deployment defaults are used when absent
+	if err != nil {
+		return nil, err, errCode
+	}
+
+	if textSSML, present := t["ssml"]; present {
+		ttsReq, err, errCode := ExtractSSML(t, textSSML, format)
+		if err != nil {
+			return nil, err, errCode
+		}
+		ttsReq.Processing = processing
+		return ttsReq, nil, 0
 	}
 
 	answerText, ok := t["text"].(string)
 
 	if !ok { // text field is not present
 		err = errors.New("Object contains no field 'text'") // handle error for incorrect json object
-		return "", err, http.StatusBadRequest
+		return nil, err, http.StatusBadRequest
 	}
 
 	println(answerText)
 
-	return answerText, nil, 0
+	options, err, errCode := VoiceOptions(t) // optional, the configured defaults are used when absent
+	if err != nil {
+		return nil, err, errCode
+	}
+
+	return &ttsRequest{Text: answerText, Format: format, voiceOptions: options, Processing: processing}, nil, 0
+}
+
+// ExtractSSML reads a request that sends its own ssml, which chooses its own voice and prosody.
+func ExtractSSML(t map[string]interface{}, ssmlField interface{}, format string) (*ttsRequest, error, int) {
+	textSSML, ok := ssmlField.(string)
+	if !ok || strings.TrimSpace(textSSML) == "" {
+		return nil, errors.New("Field 'ssml' must be a non-empty string"), http.StatusBadRequest
+	}
+	for _, field := range []string{"text", "voice", "locale", "rate", "pitch", "volume", "style", "styleDegree", "role"} {
+		if _, present := t[field]; present {
+			err := errors.New("Field '" + field + "' can't be combined with 'ssml' - Set it in the ssml instead")
+			return nil, err, http.StatusBadRequest
+		}
+	}
+
+	println(textSSML)
+
+	err, errCode := CheckSSML(textSSML)
+	if err != nil {
+		return nil, err, errCode
+	}
+
+	return &ttsRequest{SSML: textSSML, Format: format}, nil, 0
 }
 
-func TextToSpeech(textSSML []byte) (string, error, int) {
-	client := &http.Client{}
-	ttsReq, err := http.NewRequest("POST", URI, bytes.NewBuffer(textSSML))
+func TextToSpeech(textSSML []byte, format string) ([]byte, string, error, int) {
+	client := &http.Client{Timeout: speechTimeout} // a region that times out is failed over
+	ttsReq, err := http.NewRequest("POST", ttsRegions[0].Endpoint, bytes.NewBuffer(textSSML))
 	if err != nil {
-		return "", err, http.StatusBadRequest // the request was malformed
+		return nil, "", err, http.StatusBadRequest // the request was malformed
 	}
 
 	ttsReq.Header.Set("Content-Type", "application/ssml+xml")
-	ttsReq.Header.Set("Ocp-Apim-Subscription-Key", KEY)
-	ttsReq.Header.Set("X-Microsoft-OutputFormat", "riff-16khz-16bit-mono-pcm")
+	ttsReq.Header.Set("X-Microsoft-OutputFormat", format)
 
-	ttsResp, err := client.Do(ttsReq)
+	ttsResp, region, err := DoRegional(client, ttsRegions, ttsReq) // falls back to the next region on server errors
 	if err != nil {
-		return "", err, http.StatusNotFound // microsoft text-to-speech could not be reached
+		return nil, region, err, http.StatusNotFound // microsoft text-to-speech could not be reached
 	}
 
 	// the request was not successful
 	if ttsResp.StatusCode != http.StatusOK {
 		err = CheckTTSStatusErr(ttsResp.StatusCode) // long text error message
 		if err != nil {
-			return "", err, ttsResp.StatusCode // pass the microsoft tts error code to our own microservice response header
+			return nil, region, err, ttsResp.StatusCode // pass the microsoft tts error code to our own microservice response header
 		}
 	}
 
 	defer ttsResp.Body.Close() // defer ensures the response body is closed even in case of runtime error during parsing of response
 
-	ttsRespBody, err := ioutil.ReadAll(ttsResp.Body)
+	answerSpeech, err := ioutil.ReadAll(ttsResp.Body)
 	if err != nil {
-		return "", err, http.StatusInternalServerError // could not read the body of the response, perceived to be client error
+		return nil, region, err, http.StatusInternalServerError // could not read the body of the response, perceived to be client error
 	}
 
-	answerSpeech := base64.StdEncoding.EncodeToString(ttsRespBody) // converts the string to base64 encoded wav
-
-	return answerSpeech, nil, 0
+	return answerSpeech, region, nil, 0
 }
 
-func CreateSSML(answerText string) ([]byte, error, int) {
+func CreateSSML(ttsReq *ttsRequest) ([]byte, error, int) {
+	fragments := lexicon.Pronounce(ttsReq.Text)                         // names and acronyms from the lexicon
+	content := FragmentsSSML(NormalizeSpeech(fragments, ttsReq.Locale)) // units, dates and currency read as words
 	speak := &speak{
 		Version: "1.0",
-		Lang:    "en-US",
+		Xmlns:   SSML_NAMESPACE,
+		Mstts:   MSTTS_NAMESPACE,
+		Lang:    ttsReq.Locale,
 		Voice: voice{
-			Voice: answerText,
-			Lang:  "en-US",
-			Name:  "en-US-JennyNeural",
+			Lang: ttsReq.Locale,
+			Name: ttsReq.Voice,
 		},
 	}
 
+	// the text is wrapped in prosody, then express-as, then the voice
+	var textProsody *prosody
+	if ttsReq.Rate != "" || ttsReq.Pitch != "" || ttsReq.Volume != "" {
+		textProsody = &prosody{Rate: ttsReq.Rate, Pitch: ttsReq.Pitch, Volume: ttsReq.Volume, Content: content}
+		content = ""
+	}
+	if ttsReq.Style != "" || ttsReq.Role != "" {
+		speak.Voice.ExpressAs = &expressAs{Style: ttsReq.Style, Role: ttsReq.Role, Prosody: textProsody, Content: content}
+		if ttsReq.Degree != 0 {
+			speak.Voice.ExpressAs.StyleDegree = strconv.FormatFloat(ttsReq.Degree, 'f', -1, 64)
+		}
+	} else {
+		speak.Voice.Prosody, speak.Voice.Content = textProsody, content
+	}
+
 	textSSML, err := xml.MarshalIndent(speak, "", "    ") // Speech Synthesis Markup Language
 	if err != nil {
 		return nil, err, http.StatusBadRequest // could not generate the xml request file due to perceived client error
@@ -145,31 +277,45 @@ func CheckTTSStatusErr(errStatus int) error {
 	return errors.New("Microsoft text-to-speech could not determine the specific error - Refer to error status code!")
 }
 
-func TTSResponse(w http.ResponseWriter, answer_speech string) {
+func TTSResponse(w http.ResponseWriter, answerSpeech []byte, region string, format string) {
 	w.WriteHeader(http.StatusOK)
-	u := map[string]interface{}{"speech": answer_speech}
+	answer_speech := base64.StdEncoding.EncodeToString(answerSpeech) // converts the audio to base64 encoded audio in the chosen format
+	u := map[string]interface{}{"speech": answer_speech, "region": region, "format": format, "mimeType": FormatMimeType(format)}
 	w.Header().Set("Content-Type", "application/json") // return microservice response as json
 	json.NewEncoder(w).Encode(u)
 }
 
 func TTSErrResponse(w http.ResponseWriter, err error, errCode int) {
+	message := RedactSecrets(err.Error()) // keys must never reach the console or the caller
 	w.WriteHeader(errCode)
-	w.Write([]byte(err.Error()))
+	w.Write([]byte(message))
 	w.Header().Set("Content-Type", "text") // return error message as text
 	println(errCode)
-	println(err.Error()) // display the error message on the console
+	println(message) // display the error message on the console
 }
 
 func TTSHandler() {
 	r := mux.NewRouter()
 	// document
 	r.HandleFunc("/tts", ProcessTTS).Methods("POST")
+	r.HandleFunc("/tts/ssml", PreviewSSML).Methods("POST")
+	r.HandleFunc("/tts/voices", ListVoices).Methods("GET")
 	http.ListenAndServe(":3003", r)
 	//	3001 / alpha
 	//	3002 / stt
 	//	3003 / tts
 }
 
+// go run tts.go ttscatalog.go ttschunk.go ttsformat.go ttslexicon.go ttsnormalize.go ttsoffline.go ttspostprocess.go ttsssml.go ttssynthesizer.go ttsvoice.go config.go secrets.go speechauth.go speechregion.go wav.go
 func main() {
+	MustCheckDefaultFormat()
+	MustCheckDefaultProsody()
+	backend := EnvString("TTS_BACKEND", "azure")
+	synthesizer = NewSynthesizer(backend)
+	if backend == "azure" { // the offline voices are the configured ones
+		catalog.FetchVoices()
+	}
+	lexicon = MustLoadLexicon(lexiconFile)
+	chime = MustLoadChime(chimeFile)
 	TTSHandler()
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The voices requests may choose from are microsoft's own list for the region, fetched at startup
+// and refreshed every TTS_VOICES_REFRESH. Until it has been fetched, or with the offline backend,
+// the configured TTS_VOICES are the catalog.
+
+const VOICES_URI = "https://{region}.tts.speech.microsoft.com/" +
+	"cognitiveservices/voices/list"
+
+var (
+	// follows TTS_ENDPOINT when that is overridden, e.g. to azurestub.go
+	voicesRegions = SpeechRegions(EnvString("TTS_VOICES_ENDPOINT",
+		strings.Replace(EnvString("TTS_ENDPOINT", VOICES_URI), "cognitiveservices/v1", "cognitiveservices/voices/list", 1)))
+	voicesRefresh = EnvDuration("TTS_VOICES_REFRESH", 24*time.Hour)
+	voicesRetry   = EnvDuration("TTS_VOICES_RETRY", time.Minute) // after a failed fetch
+)
+
+type catalogVoice struct {
+	Name        string   `json:"name"` // short name used in ssml, e.g. en-GB-SoniaNeural
+	DisplayName string   `json:"displayName,omitempty"`
+	Gender      string   `json:"gender,omitempty"`
+	Locale      string   `json:"locale"`
+	Styles      []string `json:"styles"`
+	Roles       []string `json:"roles"`
+}
+
+type voiceCatalog struct {
+	mu      sync.RWMutex
+	voices  []catalogVoice
+	names   map[string]bool
+	source  string // azure or configured
+	fetched time.Time
+}
+
+var catalog = ConfiguredCatalog()
+
+// ConfiguredCatalog holds the TTS_VOICES, whose genders and styles aren't known.
+func ConfiguredCatalog() *voiceCatalog {
+	voices := []catalogVoice{}
+	for _, name := range configuredVoices {
+		voices = append(voices, catalogVoice{Name: name, Locale: VoiceLocale(name), Styles: []string{}, Roles: []string{}})
+	}
+	catalog := &voiceCatalog{}
+	catalog.set(voices, "configured")
+	return catalog
+}
+
+// FetchVoices replaces the catalog with azure's list, then keeps it up to date.
+func (catalog *voiceCatalog) FetchVoices() {
+	next := voicesRefresh
+	if err := catalog.fetch(); err != nil {
+		println("Could not fetch the voice list, using " + strconv.Itoa(len(catalog.Voices())) + " " + catalog.Source() +
+			" voices - " + RedactSecrets(err.Error()))
+		next = voicesRetry
+	}
+	time.AfterFunc(next, catalog.FetchVoices)
+}
+
+func (catalog *voiceCatalog) fetch() error {
+	client := &http.Client{Timeout: speechTimeout}
+	req, err := http.NewRequest("GET", voicesRegions[0].Endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, region, err := DoRegional(client, voicesRegions, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Region " + region + " returned " + strconv.Itoa(resp.StatusCode))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	azureVoices := []struct {
+		ShortName    string
+		DisplayName  string
+		Gender       string
+		Locale       string
+		StyleList    []string
+		RolePlayList []string
+	}{}
+	if err = json.Unmarshal(body, &azureVoices); err != nil {
+		return err
+	}
+	if len(azureVoices) == 0 {
+		return errors.New("Region " + region + " listed no voices")
+	}
+
+	voices := []catalogVoice{}
+	for _, voice := range azureVoices {
+		voices = append(voices, catalogVoice{Name: voice.ShortName, DisplayName: voice.DisplayName, Gender: voice.Gender,
+			Locale: voice.Locale, Styles: append([]string{}, voice.StyleList...), Roles: append([]string{}, voice.RolePlayList...)})
+	}
+	sort.Slice(voices, func(i, j int) bool { return voices[i].Name < voices[j].Name })
+	catalog.set(voices, "azure")
+
+	println("Fetched " + strconv.Itoa(len(voices)) + " voices from " + region)
+	return nil
+}
+
+func (catalog *voiceCatalog) set(voices []catalogVoice, source string) {
+	names := map[string]bool{}
+	for _, voice := range voices {
+		names[voice.Name] = true
+	}
+
+	catalog.mu.Lock()
+	catalog.voices, catalog.names, catalog.source, catalog.fetched = voices, names, source, time.Now()
+	catalog.mu.Unlock()
+}
+
+func (catalog *voiceCatalog) Voices() []catalogVoice {
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	return catalog.voices // replaced rather than modified, so safe to share
+}
+
+func (catalog *voiceCatalog) Source() string {
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	return catalog.source
+}
+
+func (catalog *voiceCatalog) Has(name string) bool {
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	return catalog.names[name]
+}
+
+// LocaleVoice picks a voice for the locale, preferring the configured TTS_VOICES in their order.
+func (catalog *voiceCatalog) LocaleVoice(locale string) string {
+	for _, voice := range configuredVoices {
+		if strings.EqualFold(VoiceLocale(voice), locale) && catalog.Has(voice) {
+			return voice
+		}
+	}
+	for _, voice := range catalog.Voices() {
+		if strings.EqualFold(voice.Locale, locale) {
+			return voice.Name
+		}
+	}
+	return ""
+}
+
+// ListVoices answers GET /tts/voices, optionally filtered by ?locale=en-GB (or just the language,
+// en), ?gender=female and ?style=cheerful
+func ListVoices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	locale, gender, style := query.Get("locale"), query.Get("gender"), query.Get("style")
+
+	voices := []catalogVoice{}
+	for _, voice := range catalog.Voices() {
+		if locale != "" && !strings.EqualFold(voice.Locale, locale) && !strings.EqualFold(strings.SplitN(voice.Locale, "-", 2)[0], locale) {
+			continue
+		}
+		if gender != "" && !strings.EqualFold(voice.Gender, gender) {
+			continue
+		}
+		if style != "" && !Contains(voice.Styles, style) {
+			continue
+		}
+		voices = append(voices, voice)
+	}
+
+	catalog.mu.RLock()
+	source, fetched := catalog.source, catalog.fetched
+	catalog.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"voices": voices, "count": len(voices), "source": source,
+		"updated": fetched.UTC().Format(time.RFC3339)})
+}
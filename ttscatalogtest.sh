@@ -0,0 +1,47 @@
+#!/bin/sh
+# Checks the voice catalog fetched from the local stand-in, start the stand-in and tts first:
+#   go run azurestub.go
+#   export SPEECH_KEY=stub SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken
+#   TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 go run tts.go ...
+FAILED=0
+
+check() { # check <description> <url> <expected status> <expected text in response> [<text that must not appear>]
+	STATUS=`curl -s -o output -w "%{http_code}" "$2"`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output && { [ -z "$5" ] || ! grep -q -- "$5" output; }; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+synthesize() { # synthesize <description> <json request> <expected status> <expected text in response>
+	echo "$2" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3003/tts`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+check "every voice" localhost:3003/tts/voices 200 '"count":11,"source":"azure"'
+check "voice details" localhost:3003/tts/voices 200 '{"name":"en-GB-SoniaNeural","displayName":"Sonia","gender":"Female","locale":"en-GB","styles":\["cheerful","sad"\],"roles":\[\]}'
+check "by locale" "localhost:3003/tts/voices?locale=en-GB" 200 '"count":3' en-US
+check "by language" "localhost:3003/tts/voices?locale=en" 200 '"count":9'
+check "by gender" "localhost:3003/tts/voices?gender=male" 200 '"count":3' '"Female"'
+check "by style" "localhost:3003/tts/voices?style=empathetic" 200 '"name":"en-US-AriaNeural"' JennyNeural
+check "combined filters" "localhost:3003/tts/voices?locale=en-GB&gender=female&style=cheerful" 200 '"count":1,'
+check "no match" "localhost:3003/tts/voices?locale=fr-FR" 200 '"voices":\[\]'
+
+synthesize "listed voice outside TTS_VOICES" '{"text":"Hello","voice":"en-GB-LibbyNeural"}' 200 '"region"'
+synthesize "unlisted voice" '{"text":"Hello","voice":"en-US-DavisNeural"}' 400 "is not in the catalog - See GET /tts/voices"
+synthesize "locale prefers TTS_VOICES" '{"text":"Hello","locale":"en-GB"}' 200 '"region"'
+curl -s localhost:3010/stub/ssml | grep -q 'en-GB-SoniaNeural' && echo "PASS preferred voice" || { echo "FAIL preferred voice"; FAILED=1; }
+synthesize "locale only in the list" '{"text":"Hello","locale":"en-IN"}' 200 '"region"'
+curl -s localhost:3010/stub/ssml | grep -q 'en-IN-PrabhatNeural' && echo "PASS listed voice" || { echo "FAIL listed voice"; FAILED=1; }
+synthesize "ssml voices checked" '{"ssml":"<speak version=\"1.0\" xml:lang=\"en-US\"><voice name=\"en-US-DavisNeural\">Hi</voice></speak>"}' 400 "is not in the catalog"
+
+rm -f input output
+exit $FAILED
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Long answers, such as full results or knowledge base passages, can exceed microsoft's limits on
+// the size of a request and the length of the audio. They are split at sentence boundaries into
+// chunks of at most TTS_CHUNK_CHARS, which are synthesised concurrently and joined in order.
+
+const CHUNK_WORKERS = 4 // maximum number of chunks sent to microsoft at once
+
+var (
+	chunkChars  = int(EnvFloat("TTS_CHUNK_CHARS", 2000))
+	sentenceEnd = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+	clauseEnd   = regexp.MustCompile(`[,;:]\s+`)
+)
+
+// SplitSentences packs whole sentences into chunks of at most maxChars, splitting sentences that
+// are too long on their own at clauses, then words.
+func SplitSentences(text string, maxChars int) []string {
+	text = strings.TrimSpace(text)
+	if len(text) <= maxChars || maxChars <= 0 {
+		return []string{text}
+	}
+
+	pieces := []string{}
+	for _, sentence := range SplitAfter(text, sentenceEnd) {
+		if len(sentence) <= maxChars {
+			pieces = append(pieces, sentence)
+			continue
+		}
+		for _, clause := range SplitAfter(sentence, clauseEnd) {
+			if len(clause) <= maxChars {
+				pieces = append(pieces, clause)
+				continue
+			}
+			pieces = append(pieces, strings.Fields(clause)...) // a single word longer than maxChars is sent as it is
+		}
+	}
+
+	chunks, chunk := []string{}, ""
+	for _, piece := range pieces {
+		if chunk != "" && len(chunk)+1+len(piece) > maxChars {
+			chunks, chunk = append(chunks, chunk), ""
+		}
+		if chunk != "" {
+			chunk += " "
+		}
+		chunk += piece
+	}
+	return append(chunks, chunk)
+}
+
+// SplitAfter splits the text after every match of the separator, trimming the spaces between pieces.
+func SplitAfter(text string, separator *regexp.Regexp) []string {
+	pieces, last := []string{}, 0
+	for _, loc := range separator.FindAllStringIndex(text, -1) {
+		pieces = append(pieces, strings.TrimSpace(text[last:loc[1]]))
+		last = loc[1]
+	}
+	if rest := strings.TrimSpace(text[last:]); rest != "" {
+		pieces = append(pieces, rest)
+	}
+	return pieces
+}
+
+// SynthesizeChunks speaks each chunk of the text with the request's voice and joins the audio.
+func SynthesizeChunks(ttsReq *ttsRequest, chunks []string) ([]byte, string, error, int) {
+	if !strings.HasPrefix(ttsReq.Format, "riff-") { // compressed audio can't be joined without decoding it
+		err := fmt.Errorf("The text is %d characters, longer than the %d that can be spoken in %s - Use a riff format or shorten the text",
+			len(ttsReq.Text), chunkChars, ttsReq.Format)
+		return nil, "", err, http.StatusRequestEntityTooLarge
+	}
+
+	chunkSpeech := make([][]byte, len(chunks))
+	chunkRegion := make([]string, len(chunks))
+	chunkErrs := make([]error, len(chunks))
+	chunkErrCodes := make([]int, len(chunks))
+
+	workers := make(chan struct{}, CHUNK_WORKERS) // bounds the number of concurrent requests
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			chunkReq := *ttsReq
+			chunkReq.Text = chunks[i]
+			textSSML, err, errCode := CreateSSML(&chunkReq)
+			if err != nil {
+				chunkErrs[i], chunkErrCodes[i] = err, errCode
+				return
+			}
+			chunkSpeech[i], chunkRegion[i], chunkErrs[i], chunkErrCodes[i] = synthesizer.Synthesize(textSSML, ttsReq.Format)
+		}(i)
+	}
+	wg.Wait()
+
+	wavs, regions := []*WAV{}, []string{}
+	for i := range chunks { // report the earliest failure
+		if chunkErrs[i] != nil {
+			err := fmt.Errorf("Chunk %d of %d could not be synthesized: %v", i+1, len(chunks), chunkErrs[i])
+			return nil, "", err, chunkErrCodes[i]
+		}
+
+		wav, err := ParseWAV(chunkSpeech[i])
+		if err != nil {
+			return nil, "", fmt.Errorf("Chunk %d of %d did not return a valid WAV - %v", i+1, len(chunks), err), http.StatusBadGateway
+		}
+		wavs = append(wavs, wav)
+		if !Contains(regions, chunkRegion[i]) { // chunks may have been failed over to different regions
+			regions = append(regions, chunkRegion[i])
+		}
+	}
+
+	joined, err := ConcatWAV(wavs)
+	if err != nil {
+		return nil, "", err, http.StatusBadGateway
+	}
+
+	println("Joined", len(chunks), "chunks into", joined.Duration().String(), "of speech")
+
+	return joined.Bytes(), strings.Join(regions, ","), nil, 0
+}
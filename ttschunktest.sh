@@ -0,0 +1,50 @@
+#!/bin/sh
+# Checks long answers are synthesised in chunks and joined into one WAV, start the stand-in and tts
+# with short chunks first:
+#   go run azurestub.go
+#   export SPEECH_KEY=stub SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken
+#   TTS_CHUNK_CHARS=80 TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 go run tts.go ...
+FAILED=0
+
+LONG="Paris is the capital of France. It lies on the Seine, in the north of the country. \
+The city has a population of more than two million people! Is it the most visited city in the world? \
+Many say so; the Louvre alone receives millions of visitors, and the Eiffel Tower almost as many."
+
+check() { # check <description> <json request> <expected status> <expected text in response> [<expected sample rate>]
+	echo "$2" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3003/tts`
+	grep -o '"speech":"[^"]*"' output | cut -d '"' -f4 | base64 -d > speech 2>/dev/null
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output && { [ -z "$5" ] || valid_wav "$5"; }; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+field() { # field <offset> <bytes> prints the little endian number at the offset of the speech
+	od -An -t u$2 -j $1 -N $2 speech | tr -d ' '
+}
+
+valid_wav() { # the riff and data sizes must match the joined audio
+	SIZE=`wc -c < speech`
+	[ "`head -c 4 speech`" = "RIFF" ] && [ "`field 4 4`" = "$((SIZE - 8))" ] &&
+		[ "`field 40 4`" = "$((SIZE - 44))" ] && [ "`field 24 4`" = "$1" ] && [ "$SIZE" -gt 44 ]
+}
+
+check "short text in one request" '{"text":"Paris is the capital of France."}' 200 '"region"' 16000
+check "long text joined into one wav" "{\"text\":\"$LONG\"}" 200 '"region"' 16000
+check "long text at 48kHz" "{\"text\":\"$LONG\",\"format\":\"riff-48khz-16bit-mono-pcm\"}" 200 '"region"' 48000
+check "long text as mp3" "{\"text\":\"$LONG\",\"format\":\"audio-16khz-32kbitrate-mono-mp3\"}" 413 "Use a riff format"
+
+# the stand-in speaks 60ms per character, so every sentence must be in the joined audio
+check "long text keeps every chunk" "{\"text\":\"$LONG\"}" 200 '"region"' 16000
+SAMPLES=$((`field 40 4` / 2))
+[ "$SAMPLES" -gt $((16000 * 60 / 1000 * 250)) ] && echo "PASS chunks joined in full" || { echo "FAIL only $SAMPLES samples"; FAILED=1; }
+
+curl -s localhost:3010/stub/ssml > output
+grep -q "<voice" output && ! grep -q "Paris.*Eiffel" output && echo "PASS chunks sent separately" ||
+	{ echo "FAIL last ssml `head -c 300 output`"; FAILED=1; }
+
+rm -f input output speech
+exit $FAILED
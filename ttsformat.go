@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// outputFormats are the X-Microsoft-OutputFormat values microsoft supports and the mime type of each.
+var outputFormats = map[string]string{
+	"riff-8khz-16bit-mono-pcm":          "audio/wav",
+	"riff-16khz-16bit-mono-pcm":         "audio/wav",
+	"riff-22050hz-16bit-mono-pcm":       "audio/wav",
+	"riff-24khz-16bit-mono-pcm":         "audio/wav",
+	"riff-44100hz-16bit-mono-pcm":       "audio/wav",
+	"riff-48khz-16bit-mono-pcm":         "audio/wav",
+	"riff-8khz-8bit-mono-mulaw":         "audio/wav",
+	"riff-8khz-8bit-mono-alaw":          "audio/wav",
+	"raw-16khz-16bit-mono-pcm":          "audio/L16; rate=16000; channels=1",
+	"raw-24khz-16bit-mono-pcm":          "audio/L16; rate=24000; channels=1",
+	"raw-48khz-16bit-mono-pcm":          "audio/L16; rate=48000; channels=1",
+	"audio-16khz-32kbitrate-mono-mp3":   "audio/mpeg",
+	"audio-16khz-64kbitrate-mono-mp3":   "audio/mpeg",
+	"audio-16khz-128kbitrate-mono-mp3":  "audio/mpeg",
+	"audio-24khz-48kbitrate-mono-mp3":   "audio/mpeg",
+	"audio-24khz-96kbitrate-mono-mp3":   "audio/mpeg",
+	"audio-24khz-160kbitrate-mono-mp3":  "audio/mpeg",
+	"audio-48khz-96kbitrate-mono-mp3":   "audio/mpeg",
+	"audio-48khz-192kbitrate-mono-mp3":  "audio/mpeg",
+	"ogg-16khz-16bit-mono-opus":         "audio/ogg; codecs=opus",
+	"ogg-24khz-16bit-mono-opus":         "audio/ogg; codecs=opus",
+	"ogg-48khz-16bit-mono-opus":         "audio/ogg; codecs=opus",
+	"webm-16khz-16bit-mono-opus":        "audio/webm; codecs=opus",
+	"webm-24khz-16bit-mono-opus":        "audio/webm; codecs=opus",
+	"webm-24khz-16bit-24kbps-mono-opus": "audio/webm; codecs=opus",
+}
+
+// TTS_FORMAT is used by requests that don't choose a format
+var defaultFormat = EnvString("TTS_FORMAT", "riff-16khz-16bit-mono-pcm")
+
+// MustCheckDefaultFormat exits at startup rather than failing every request with a mistyped TTS_FORMAT.
+func MustCheckDefaultFormat() {
+	if err, _ := CheckFormat(defaultFormat); err != nil {
+		println("Invalid TTS_FORMAT - " + err.Error())
+		os.Exit(1)
+	}
+}
+
+// OutputFormat reads the optional format field of a /tts request.
+func OutputFormat(t map[string]interface{}) (string, error, int) {
+	format, present := t["format"]
+	if !present {
+		return defaultFormat, nil, 0
+	}
+
+	requestFormat, ok := format.(string)
+	if !ok {
+		return "", errors.New("Field 'format' must be a string"), http.StatusBadRequest
+	}
+	err, errCode := CheckFormat(requestFormat)
+	return requestFormat, err, errCode
+}
+
+func CheckFormat(format string) (error, int) {
+	if _, ok := outputFormats[format]; !ok {
+		formats := []string{}
+		for supported := range outputFormats {
+			formats = append(formats, supported)
+		}
+		sort.Strings(formats)
+		return errors.New("The output format '" + format + "' is not supported - Choose one of " + strings.Join(formats, ", ")),
+			http.StatusBadRequest
+	}
+	return nil, 0
+}
+
+func FormatMimeType(format string) string {
+	return outputFormats[format]
+}
@@ -0,0 +1,35 @@
+#!/bin/sh
+# Checks the output formats against the local stand-in, start the stand-in and every microservice first:
+#   go run azurestub.go
+#   export SPEECH_KEY=stub SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken
+#   STT_ENDPOINT=http://localhost:3010/speech/recognition/conversation/cognitiveservices/v1 go run stt.go ...
+#   TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 go run tts.go ...
+#   go run alpha.go ... and go run alexa.go ...
+FAILED=0
+
+check() { # check <description> <url> <json request> <expected status> <expected text in response> [<expected audio magic>]
+	echo "$3" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input $2`
+	MAGIC=`grep -o '"speech":"[^"]*"' output | cut -d '"' -f4 | base64 -d 2>/dev/null | head -c 4`
+	if [ "$STATUS" = "$4" ] && grep -q -- "$5" output && [ -z "$6" -o "$MAGIC" = "$6" ]; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+check "default format" localhost:3003/tts '{"text":"Hello"}' 200 '"format":"riff-16khz-16bit-mono-pcm","mimeType":"audio/wav"' RIFF
+check "48kHz pcm" localhost:3003/tts '{"text":"Hello","format":"riff-48khz-16bit-mono-pcm"}' 200 '"mimeType":"audio/wav"' RIFF
+check "mp3" localhost:3003/tts '{"text":"Hello","format":"audio-24khz-96kbitrate-mono-mp3"}' 200 '"mimeType":"audio/mpeg"' ID3
+check "ogg opus" localhost:3003/tts '{"text":"Hello","format":"ogg-48khz-16bit-mono-opus"}' 200 '"mimeType":"audio/ogg; codecs=opus"' OggS
+check "webm opus" localhost:3003/tts '{"text":"Hello","format":"webm-24khz-16bit-mono-opus"}' 200 '"mimeType":"audio/webm; codecs=opus"'
+check "unsupported format" localhost:3003/tts '{"text":"Hello","format":"flac-96khz"}' 400 "is not supported - Choose one of"
+check "format must be a string" localhost:3003/tts '{"text":"Hello","format":48}' 400 "must be a string"
+
+SPEECH=`base64 -i speech.wav | tr -d "\n"`
+check "alexa passes the format on" localhost:3000/alexa "{\"speech\":\"$SPEECH\",\"format\":\"audio-16khz-32kbitrate-mono-mp3\"}" 200 '"mimeType":"audio/mpeg"' ID3
+check "alexa default format" localhost:3000/alexa "{\"speech\":\"$SPEECH\"}" 200 '"mimeType":"audio/wav"' RIFF
+
+rm -f input output
+exit $FAILED
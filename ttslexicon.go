@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The lexicon file fixes the pronunciation of names and acronyms the voices get wrong, one word or
+// phrase per line with either its IPA pronunciation or an alias to read in its place:
+//
+//	# comment
+//	Siobhan = ipa:ʃɪˈvɔːn
+//	ECM3408 = alias:E C M thirty four oh eight
+//
+// Matching words are wrapped in <phoneme> or <sub>. The file is checked for changes every
+// TTS_LEXICON_RELOAD, so entries can be added without a restart.
+
+var (
+	lexiconFile   = EnvString("TTS_LEXICON", "") // no lexicon when unset
+	lexiconReload = EnvDuration("TTS_LEXICON_RELOAD", 10*time.Second)
+)
+
+type lexiconEntry struct {
+	Phoneme string // IPA pronunciation
+	Alias   string // text read in place of the word
+}
+
+type pronunciationLexicon struct {
+	path string
+
+	mu       sync.RWMutex
+	entries  map[string]lexiconEntry // keyed by the lowercased word
+	rule     spokenRule
+	modified time.Time
+}
+
+var lexicon *pronunciationLexicon // loaded by main, nil when there is no lexicon
+
+func MustLoadLexicon(path string) *pronunciationLexicon {
+	if path == "" {
+		return nil
+	}
+
+	lexicon := &pronunciationLexicon{path: path}
+	if err := lexicon.load(); err != nil {
+		println("Could not load the lexicon from " + path + " - " + err.Error())
+		os.Exit(1)
+	}
+	if lexiconReload > 0 {
+		go lexicon.watch()
+	}
+	return lexicon
+}
+
+func (lexicon *pronunciationLexicon) load() error {
+	info, err := os.Stat(lexicon.path)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(lexicon.path)
+	if err != nil {
+		return err
+	}
+
+	entries, err := ParseLexicon(string(contents))
+	if err != nil {
+		return err
+	}
+
+	words := make([]string, 0, len(entries))
+	for word := range entries {
+		words = append(words, word)
+	}
+	rule := spokenRule{
+		Pattern: regexp.MustCompile(`(?i)` + PhraseGroup(`(`, words, `)`)),
+		Bounded: true,
+		Expand: func(_ *spokenForms, match []string) []ssmlFragment {
+			entry := entries[strings.ToLower(match[1])]
+			return []ssmlFragment{{Text: match[1], Phoneme: entry.Phoneme, Alias: entry.Alias, Spoken: true}}
+		},
+	}
+
+	lexicon.mu.Lock()
+	lexicon.entries, lexicon.rule, lexicon.modified = entries, rule, info.ModTime()
+	lexicon.mu.Unlock()
+
+	println("Loaded", len(entries), "lexicon entries from "+lexicon.path)
+	return nil
+}
+
+func ParseLexicon(contents string) (map[string]lexiconEntry, error) {
+	entries := map[string]lexiconEntry{}
+	for number, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		word := strings.ToLower(strings.Join(strings.Fields(parts[0]), " "))
+		if len(parts) != 2 || word == "" {
+			return nil, errors.New("Line " + strconv.Itoa(number+1) + " is not written as word = ipa:... or word = alias:...")
+		}
+
+		pronunciation := strings.TrimSpace(parts[1])
+		switch {
+		case strings.HasPrefix(pronunciation, "ipa:") && strings.TrimSpace(pronunciation[4:]) != "":
+			entries[word] = lexiconEntry{Phoneme: strings.Trim(strings.TrimSpace(pronunciation[4:]), "/")}
+		case strings.HasPrefix(pronunciation, "alias:") && strings.TrimSpace(pronunciation[6:]) != "":
+			entries[word] = lexiconEntry{Alias: strings.TrimSpace(pronunciation[6:])}
+		default:
+			return nil, errors.New("Line " + strconv.Itoa(number+1) + " needs an ipa: or alias: pronunciation")
+		}
+	}
+	return entries, nil
+}
+
+func (lexicon *pronunciationLexicon) watch() {
+	for range time.Tick(lexiconReload) {
+		info, err := os.Stat(lexicon.path)
+		lexicon.mu.RLock()
+		changed := err == nil && !info.ModTime().Equal(lexicon.modified)
+		lexicon.mu.RUnlock()
+
+		if changed {
+			if err = lexicon.load(); err != nil { // keep the old entries until the file is fixed
+				println("Could not reload the lexicon, keeping the current entries - " + err.Error())
+				lexicon.mu.Lock()
+				lexicon.modified = info.ModTime() // warn once per change
+				lexicon.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Pronounce wraps the words found in the lexicon, before the spoken forms are applied to the rest.
+func (lexicon *pronunciationLexicon) Pronounce(text string) []ssmlFragment {
+	fragments := []ssmlFragment{{Text: text}}
+	if lexicon == nil {
+		return fragments
+	}
+
+	lexicon.mu.RLock()
+	rule, empty := lexicon.rule, len(lexicon.entries) == 0
+	lexicon.mu.RUnlock()
+	if empty {
+		return fragments
+	}
+
+	return ApplySpokenRule(nil, rule, fragments)
+}
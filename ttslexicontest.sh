@@ -0,0 +1,32 @@
+#!/bin/sh
+# Checks the pronunciation lexicon with the ssml preview, start both services first:
+#   go run azurestub.go
+#   cp ttslexicontest.txt lexicon.txt
+#   TTS_LEXICON=lexicon.txt TTS_LEXICON_RELOAD=1s TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run tts.go ...
+FAILED=0
+
+check() { # check <description> <text> <expected status> <expected text in the ssml or error>
+	echo "{\"text\":\"$2\"}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3003/tts/ssml`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `cat output | tr -d "\n"`"
+		FAILED=1
+	fi
+}
+
+check "ipa phoneme" "Ask Siobhan." 200 'Ask <phoneme alphabet="ipa" ph="ʃɪˈvɔːn">Siobhan</phoneme>.'
+check "alias" "Welcome to ECM3408" 200 '<sub alias="E C M thirty four oh eight">ECM3408</sub>'
+check "phrases and any case" "ask wolfram alpha" 200 '<sub alias="wolf rum alpha">wolfram alpha</sub>'
+check "whole words only" "Siobhans" 200 '>Siobhans</voice>'
+check "spoken forms still applied" "Siobhan ran 5 km" 200 '</phoneme> ran 5 kilometers'
+
+echo "Niamh = ipa:niːv" >> lexicon.txt
+sleep 2 # TTS_LEXICON_RELOAD
+check "reloaded entry" "Ask Niamh" 200 '<phoneme alphabet="ipa" ph="niːv">Niamh</phoneme>'
+cp ttslexicontest.txt lexicon.txt
+
+rm -f input output
+exit $FAILED
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/xml"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Wolfram alpha answers are written to be read, e.g. "2464 mi", "1.2×10^6 kg" or "5:30 pm EST".
+// NormalizeSpeech rewrites them into words the voice reads naturally, using the spoken forms of the
+// answer's locale, and marks dates and times with say-as so the voice reads them in full. Locales
+// without spoken forms still get the say-as markup, as that is understood in every language.
+
+var (
+	normalizeSpeech = EnvBool("TTS_NORMALIZE", true)
+	spokenSpaces    = regexp.MustCompile(`\s{2,}`)
+)
+
+// ssmlFragment is a piece of the text to be spoken. Spoken fragments have been normalised and are
+// not rewritten again, say-as fragments are wrapped in <say-as interpret-as="SayAs" format="Format">,
+// and words from the lexicon in <phoneme> or <sub>.
+type ssmlFragment struct {
+	Text    string
+	SayAs   string
+	Format  string
+	Phoneme string
+	Alias   string
+	Spoken  bool
+}
+
+// spokenForms are the words used to read out the written forms of one locale.
+type spokenForms struct {
+	Units         map[string][2]string // abbreviation to singular and plural, e.g. "mi": {"mile", "miles"}
+	Currencies    map[string][4]string // symbol or code to unit, units, subunit and subunits
+	Abbreviations map[string]string
+	Symbols       map[string]string // read wherever they appear, e.g. "~": "about"
+	Months        map[string]string // abbreviated month names, only expanded before a day or year
+	TimeZones     map[string]string
+	Scales        map[int]string // power of ten to its name, e.g. 6: "million"
+	DateOrder     string         // say-as format of dd/dd/yyyy dates, mdy or dmy
+	And           string         // joins units and subunits, e.g. "5 dollars and 20 cents"
+	TimesTen      string         // reads 10^n in scientific notation that has no scale name
+	Minus         string
+
+	rules []spokenRule
+}
+
+// spokenRule rewrites every match of its pattern. Bounded rules only match whole words and numbers.
+type spokenRule struct {
+	Pattern *regexp.Regexp
+	Bounded bool
+	Expand  func(forms *spokenForms, match []string) []ssmlFragment
+}
+
+var enUS = &spokenForms{
+	Units: map[string][2]string{
+		"mi": {"mile", "miles"}, "km": {"kilometer", "kilometers"}, "m": {"meter", "meters"},
+		"cm": {"centimeter", "centimeters"}, "mm": {"millimeter", "millimeters"}, "nm": {"nanometer", "nanometers"},
+		"ft": {"foot", "feet"}, "yd": {"yard", "yards"}, // not "in", which is far more often the word
+		"ly": {"light year", "light years"}, "au": {"astronomical unit", "astronomical units"},
+		"m^2": {"square meter", "square meters"}, "m²": {"square meter", "square meters"},
+		"km^2": {"square kilometer", "square kilometers"}, "km²": {"square kilometer", "square kilometers"},
+		"mi^2": {"square mile", "square miles"}, "mi²": {"square mile", "square miles"},
+		"ft^2": {"square foot", "square feet"}, "ft²": {"square foot", "square feet"},
+		"m^3": {"cubic meter", "cubic meters"}, "m³": {"cubic meter", "cubic meters"},
+		"cm^3": {"cubic centimeter", "cubic centimeters"}, "cm³": {"cubic centimeter", "cubic centimeters"},
+		"kg": {"kilogram", "kilograms"}, "g": {"gram", "grams"}, "mg": {"milligram", "milligrams"},
+		"lb": {"pound", "pounds"}, "lbs": {"pounds", "pounds"}, "oz": {"ounce", "ounces"},
+		"L": {"liter", "liters"}, "mL": {"milliliter", "milliliters"}, "gal": {"gallon", "gallons"},
+		"ms": {"millisecond", "milliseconds"}, "s": {"second", "seconds"}, "sec": {"second", "seconds"},
+		"min": {"minute", "minutes"}, "h": {"hour", "hours"}, "hr": {"hour", "hours"}, "hrs": {"hours", "hours"},
+		"mph": {"mile per hour", "miles per hour"}, "km/h": {"kilometer per hour", "kilometers per hour"},
+		"m/s": {"meter per second", "meters per second"},
+		"°C":  {"degree Celsius", "degrees Celsius"}, "°F": {"degree Fahrenheit", "degrees Fahrenheit"},
+		"°": {"degree", "degrees"}, "K": {"kelvin", "kelvins"}, "%": {"percent", "percent"},
+		"Hz": {"hertz", "hertz"}, "kHz": {"kilohertz", "kilohertz"}, "MHz": {"megahertz", "megahertz"},
+		"GHz": {"gigahertz", "gigahertz"}, "W": {"watt", "watts"}, "kW": {"kilowatt", "kilowatts"},
+		"MW": {"megawatt", "megawatts"}, "kWh": {"kilowatt hour", "kilowatt hours"}, "V": {"volt", "volts"},
+		"J": {"joule", "joules"}, "kJ": {"kilojoule", "kilojoules"}, "kcal": {"kilocalorie", "kilocalories"},
+		"cal": {"calorie", "calories"}, "KB": {"kilobyte", "kilobytes"}, "MB": {"megabyte", "megabytes"},
+		"GB": {"gigabyte", "gigabytes"}, "TB": {"terabyte", "terabytes"},
+	},
+	Currencies: map[string][4]string{
+		"$": {"dollar", "dollars", "cent", "cents"}, "USD": {"US dollar", "US dollars", "cent", "cents"},
+		"£": {"pound", "pounds", "penny", "pence"}, "GBP": {"pound sterling", "pounds sterling", "penny", "pence"},
+		"€": {"euro", "euros", "cent", "cents"}, "EUR": {"euro", "euros", "cent", "cents"},
+		"¥": {"yen", "yen", "sen", "sen"}, "JPY": {"yen", "yen", "sen", "sen"},
+	},
+	Abbreviations: map[string]string{
+		"approx.": "approximately", "e.g.": "for example", "i.e.": "that is", "etc.": "et cetera",
+		"vs.": "versus", "ca.": "circa", "Dr.": "Doctor", "Mr.": "Mister", "Mrs.": "Missus", "Prof.": "Professor",
+		"Mt.": "Mount", "avg.": "average", "est.": "estimated",
+	},
+	Symbols: map[string]string{"~": "about", "≈": "approximately", "±": "plus or minus"},
+	Months: map[string]string{
+		"Jan": "January", "Feb": "February", "Mar": "March", "Apr": "April", "Jun": "June", "Jul": "July",
+		"Aug": "August", "Sep": "September", "Sept": "September", "Oct": "October", "Nov": "November", "Dec": "December",
+	},
+	TimeZones: map[string]string{
+		"EST": "Eastern Standard Time", "EDT": "Eastern Daylight Time", "CST": "Central Standard Time",
+		"CDT": "Central Daylight Time", "MST": "Mountain Standard Time", "MDT": "Mountain Daylight Time",
+		"PST": "Pacific Standard Time", "PDT": "Pacific Daylight Time", "GMT": "Greenwich Mean Time",
+		"BST": "British Summer Time", "UTC": "U T C", "CET": "Central European Time", "CEST": "Central European Summer Time",
+	},
+	Scales:    map[int]string{3: "thousand", 6: "million", 9: "billion", 12: "trillion"},
+	DateOrder: "mdy",
+	And:       "and",
+	TimesTen:  "times ten to the power of",
+	Minus:     "minus",
+}
+
+// spokenLocales are looked up by locale, then by language, e.g. en-AU uses the en forms.
+var (
+	spokenLocales = map[string]*spokenForms{
+		"en-US": WithRules(enUS),
+		"en-GB": WithRules(BritishForms(enUS)),
+		"en":    WithRules(enUS),
+	}
+	sayAsOnly = WithRules(&spokenForms{}) // for locales without spoken forms
+)
+
+// BritishForms copies the american forms with british spellings and day first dates.
+func BritishForms(american *spokenForms) *spokenForms {
+	british := *american
+	british.Units = map[string][2]string{}
+	for abbreviation, names := range american.Units {
+		for i := range names {
+			names[i] = strings.NewReplacer("meter", "metre", "liter", "litre").Replace(names[i])
+		}
+		british.Units[abbreviation] = names
+	}
+	british.Currencies = map[string][4]string{}
+	for symbol, names := range american.Currencies {
+		british.Currencies[symbol] = names
+	}
+	british.Currencies["$"] = [4]string{"US dollar", "US dollars", "cent", "cents"}
+	british.DateOrder = "dmy"
+	return &british
+}
+
+func SpokenForms(locale string) *spokenForms {
+	forms, ok := spokenLocales[locale]
+	if !ok {
+		forms, ok = spokenLocales[strings.SplitN(locale, "-", 2)[0]]
+	}
+	if !ok {
+		return sayAsOnly
+	}
+	return forms
+}
+
+// WithRules compiles the rules of the forms once, when the service starts.
+func WithRules(forms *spokenForms) *spokenForms {
+	forms.rules = SpokenRules(forms)
+	return forms
+}
+
+const (
+	spokenNumber = `((?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?)` // thousands separators, but not a comma after the number
+	spokenScale  = `(?:\s+(thousand|million|billion|trillion))?`
+)
+
+// SpokenRules builds the rules for the forms, in the order they are applied. Scientific notation
+// goes first so its scale names are read with the units that follow, e.g. "1.2 million kilograms".
+func SpokenRules(forms *spokenForms) []spokenRule {
+	rules := []spokenRule{
+		{regexp.MustCompile(`(\d+(?:\.\d+)?)\s*[×x*]\s*10\^([-+]?\d+)`), false, ScientificNotation},
+		{regexp.MustCompile(`(\d+(?:\.\d+)?)[eE]([-+]?\d+)`), true, ScientificNotation},
+		{regexp.MustCompile(`\d{4}-\d{2}-\d{2}`), true, SayAsDate("ymd")},
+		{regexp.MustCompile(`\d{1,2}/\d{1,2}/\d{4}`), true, SayAsDate(forms.DateOrder)},
+		{regexp.MustCompile(`(?i)(\d{1,2}:\d{2}(?::\d{2})?)(?:\s*(am|pm|a\.m\.|p\.m\.))?` + PhraseGroup(`(?:\s+(`, Keys(forms.TimeZones), `))?`)), true, SpokenTime},
+	}
+
+	if len(forms.Currencies) > 0 {
+		symbols := Keys(forms.Currencies)
+		rules = append(rules,
+			spokenRule{regexp.MustCompile(PhraseGroup(`(`, symbols, `)\s?`) + spokenNumber + spokenScale), false, SpokenCurrency},
+			spokenRule{regexp.MustCompile(spokenNumber + spokenScale + PhraseGroup(`\s?(`, symbols, `)`)), true, SpokenCurrencyAfter})
+	}
+	if len(forms.Units) > 0 {
+		rules = append(rules,
+			spokenRule{regexp.MustCompile(spokenNumber + spokenScale + PhraseGroup(`\s*(`, UnitKeys(forms.Units, false), `)`)), true, SpokenUnit},
+			spokenRule{regexp.MustCompile(spokenNumber + spokenScale + PhraseGroup(`\s+(`, UnitKeys(forms.Units, true), `)`)), true, SpokenUnit})
+	}
+	if len(forms.Months) > 0 {
+		rules = append(rules, spokenRule{regexp.MustCompile(PhraseGroup(`(`, Keys(forms.Months), `)\.?(\s+\d+)`)), true, SpokenMonth})
+	}
+	if len(forms.Abbreviations) > 0 {
+		rules = append(rules, spokenRule{regexp.MustCompile(PhraseGroup(`(`, Keys(forms.Abbreviations), `)`)), true, SpokenAbbreviation})
+	}
+	if len(forms.Symbols) > 0 { // symbols are often written against the number, e.g. ~5
+		rules = append(rules, spokenRule{regexp.MustCompile(PhraseGroup(`(`, Keys(forms.Symbols), `)`)), false, SpokenSymbol})
+	}
+	return rules
+}
+
+// NormalizeSpeech replaces the written forms in the fragments with spoken ones.
+func NormalizeSpeech(fragments []ssmlFragment, locale string) []ssmlFragment {
+	if !normalizeSpeech {
+		return fragments
+	}
+
+	forms := SpokenForms(locale)
+	for _, rule := range forms.rules {
+		fragments = ApplySpokenRule(forms, rule, fragments)
+	}
+	for i := range fragments {
+		fragments[i].Text = spokenSpaces.ReplaceAllString(fragments[i].Text, " ") // left by expanded symbols
+	}
+	return fragments
+}
+
+func ApplySpokenRule(forms *spokenForms, rule spokenRule, fragments []ssmlFragment) []ssmlFragment {
+	applied := []ssmlFragment{}
+	for _, fragment := range fragments {
+		if fragment.Spoken || fragment.SayAs != "" {
+			applied = append(applied, fragment)
+			continue
+		}
+
+		text, last := fragment.Text, 0
+		for _, loc := range rule.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			if rule.Bounded && !WordBoundary(text, loc[0], loc[1]) {
+				continue // e.g. the "5 m" of "5 miles", left as it is
+			}
+
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = text[loc[2*i]:loc[2*i+1]]
+				}
+			}
+
+			expanded := rule.Expand(forms, match)
+			println("Spoken form: '" + match[0] + "' -> '" + FragmentsSSML(expanded) + "'")
+			applied = AppendText(applied, text[last:loc[0]])
+			for _, e := range expanded {
+				if e.Spoken || e.SayAs != "" {
+					applied = append(applied, e)
+				} else {
+					applied = AppendText(applied, e.Text) // later rules may still rewrite it
+				}
+			}
+			last = loc[1]
+		}
+		applied = AppendText(applied, text[last:])
+	}
+	return applied
+}
+
+// AppendText adds text to the fragments, joining it to the last fragment if that is still plain
+// text, so the next rule can match across the join.
+func AppendText(fragments []ssmlFragment, text string) []ssmlFragment {
+	if text == "" {
+		return fragments
+	}
+	if n := len(fragments); n > 0 && !fragments[n-1].Spoken && fragments[n-1].SayAs == "" {
+		fragments[n-1].Text += text
+		return fragments
+	}
+	return append(fragments, ssmlFragment{Text: text})
+}
+
+// WordBoundary reports whether the match is not part of a longer word or number.
+func WordBoundary(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && (IsWordRune(before) || before == '^' || before == '.') {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && IsWordRune(after) {
+		return false
+	}
+	return true
+}
+
+func IsWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func ScientificNotation(forms *spokenForms, match []string) []ssmlFragment {
+	mantissa, power := match[1], strings.TrimPrefix(match[2], "+")
+	exponent, _ := strconv.Atoi(power)
+	for power := 12; power >= 3; power -= 3 { // e.g. 1.2×10^7 is read as 12 million
+		if scale, ok := forms.Scales[power]; ok && exponent >= power && exponent-power <= 2 {
+			return []ssmlFragment{{Text: ShiftDecimal(mantissa, exponent-power) + " " + scale}}
+		}
+	}
+	if exponent >= 0 && exponent <= 2 {
+		return []ssmlFragment{{Text: ShiftDecimal(mantissa, exponent)}}
+	}
+	if forms.TimesTen == "" {
+		return []ssmlFragment{{Text: match[0], Spoken: true}}
+	}
+
+	if exponent < 0 {
+		power = forms.Minus + " " + strings.TrimPrefix(power, "-")
+	}
+	return []ssmlFragment{{Text: mantissa + " " + forms.TimesTen + " " + power}}
+}
+
+// ShiftDecimal multiplies a decimal number by 10^places without the rounding errors of floats.
+func ShiftDecimal(number string, places int) string {
+	parts := strings.SplitN(number, ".", 2)
+	whole, fraction := parts[0], ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+	for len(fraction) < places {
+		fraction += "0"
+	}
+	whole, fraction = strings.TrimLeft(whole+fraction[:places], "0"), strings.TrimRight(fraction[places:], "0")
+	if whole == "" {
+		whole = "0"
+	}
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+func SayAsDate(format string) func(*spokenForms, []string) []ssmlFragment {
+	if format == "" {
+		format = "mdy" // no spoken forms for the locale, so the most common reading
+	}
+	return func(forms *spokenForms, match []string) []ssmlFragment {
+		return []ssmlFragment{{Text: match[0], SayAs: "date", Format: format}}
+	}
+}
+
+func SpokenTime(forms *spokenForms, match []string) []ssmlFragment {
+	clock, period, zone := match[1], strings.ToLower(strings.ReplaceAll(match[2], ".", "")), match[3]
+	fragments := []ssmlFragment{{Text: clock, SayAs: "time", Format: "hms24"}}
+	if period != "" {
+		fragments[0] = ssmlFragment{Text: clock + period, SayAs: "time", Format: "hms12"}
+	}
+	if zone != "" {
+		fragments = append(fragments, ssmlFragment{Text: " " + forms.TimeZones[strings.ToUpper(zone)], Spoken: true})
+	}
+	return fragments
+}
+
+func SpokenCurrency(forms *spokenForms, match []string) []ssmlFragment {
+	return []ssmlFragment{{Text: CurrencyWords(forms.Currencies[match[1]], match[2], match[3], forms.And), Spoken: true}}
+}
+
+func SpokenCurrencyAfter(forms *spokenForms, match []string) []ssmlFragment {
+	return []ssmlFragment{{Text: CurrencyWords(forms.Currencies[match[3]], match[1], match[2], forms.And), Spoken: true}}
+}
+
+// CurrencyWords reads an amount such as 1,234.56 as "1,234 dollars and 56 cents", or 1.2 million
+// as "1.2 million dollars".
+func CurrencyWords(names [4]string, amount string, scale string, and string) string {
+	if scale != "" {
+		return amount + " " + scale + " " + names[1]
+	}
+
+	parts := strings.SplitN(amount, ".", 2)
+	words := parts[0] + " " + Plural(parts[0], names[0], names[1])
+	if len(parts) == 2 && len(parts[1]) == 2 { // whole cents, other decimals are read as a number
+		if cents := strings.TrimLeft(parts[1], "0"); cents != "" {
+			words += " " + and + " " + cents + " " + Plural(cents, names[2], names[3])
+		}
+	} else if len(parts) == 2 {
+		words = amount + " " + names[1]
+	}
+	return words
+}
+
+func SpokenUnit(forms *spokenForms, match []string) []ssmlFragment {
+	number, scale, names := match[1], match[2], forms.Units[match[3]]
+	if scale != "" {
+		return []ssmlFragment{{Text: number + " " + scale + " " + names[1], Spoken: true}}
+	}
+	return []ssmlFragment{{Text: number + " " + Plural(number, names[0], names[1]), Spoken: true}}
+}
+
+func SpokenMonth(forms *spokenForms, match []string) []ssmlFragment {
+	return []ssmlFragment{{Text: forms.Months[match[1]] + match[2]}}
+}
+
+func SpokenAbbreviation(forms *spokenForms, match []string) []ssmlFragment {
+	return []ssmlFragment{{Text: forms.Abbreviations[match[1]], Spoken: true}}
+}
+
+func SpokenSymbol(forms *spokenForms, match []string) []ssmlFragment {
+	return []ssmlFragment{{Text: " " + forms.Symbols[match[1]] + " ", Spoken: true}}
+}
+
+func Plural(number string, singular string, plural string) string {
+	if number == "1" {
+		return singular
+	}
+	return plural
+}
+
+// PhraseGroup joins the phrases into a regex alternation, longest first so "km/h" is tried before "km".
+func PhraseGroup(prefix string, phrases []string, suffix string) string {
+	sort.Slice(phrases, func(i, j int) bool { return len(phrases[i]) > len(phrases[j]) })
+	quoted := make([]string, len(phrases))
+	for i, phrase := range phrases {
+		quoted[i] = regexp.QuoteMeta(phrase)
+	}
+	if len(quoted) == 0 {
+		return prefix + `$^` + suffix // matches nothing, keeping the group numbering
+	}
+	return prefix + strings.Join(quoted, "|") + suffix
+}
+
+// UnitKeys returns the unit abbreviations that need a space before them, or those that don't. Single
+// letters are often written against numbers that aren't measurements, e.g. the 1990s, a 5K run or 5g.
+func UnitKeys(units map[string][2]string, spaced bool) []string {
+	keys := []string{}
+	for key := range units {
+		if (utf8.RuneCountInString(key) == 1 && unicode.IsLetter([]rune(key)[0])) == spaced {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func Keys(m interface{}) []string {
+	keys := []string{}
+	switch m := m.(type) {
+	case map[string]string:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string][2]string:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string][4]string:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// FragmentsSSML writes the fragments as SSML, escaping the text.
+func FragmentsSSML(fragments []ssmlFragment) string {
+	var b strings.Builder
+	for _, fragment := range fragments {
+		switch {
+		case fragment.SayAs != "":
+			b.WriteString(`<say-as interpret-as="` + EscapeAttr(fragment.SayAs) + `"`)
+			if fragment.Format != "" {
+				b.WriteString(` format="` + EscapeAttr(fragment.Format) + `"`)
+			}
+			b.WriteString(">")
+			xml.EscapeText(&b, []byte(fragment.Text))
+			b.WriteString("</say-as>")
+		case fragment.Phoneme != "":
+			b.WriteString(`<phoneme alphabet="ipa" ph="` + EscapeAttr(fragment.Phoneme) + `">`)
+			xml.EscapeText(&b, []byte(fragment.Text))
+			b.WriteString("</phoneme>")
+		case fragment.Alias != "":
+			b.WriteString(`<sub alias="` + EscapeAttr(fragment.Alias) + `">`)
+			xml.EscapeText(&b, []byte(fragment.Text))
+			b.WriteString("</sub>")
+		default:
+			xml.EscapeText(&b, []byte(fragment.Text))
+		}
+	}
+	return b.String()
+}
+
+func EscapeAttr(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value)) // quotes are escaped as well
+	return b.String()
+}
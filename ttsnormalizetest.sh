@@ -0,0 +1,67 @@
+#!/bin/sh
+# Checks the spoken forms sent for synthesis against the local stand-in, start both services first:
+#   go run azurestub.go
+#   TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run tts.go ...
+# Each line of the table is <text to speak>|<markup expected in the ssml>|<locale, en-US when empty>
+FAILED=0
+
+while IFS='|' read -r TEXT EXPECTED LOCALE; do
+	echo "{\"text\":\"$TEXT\",\"locale\":\"${LOCALE:-en-US}\"}" > input
+	curl -s -o /dev/null -X POST -d @input localhost:3003/tts
+	SSML=`curl -s localhost:3010/stub/ssml`
+	if echo "$SSML" | grep -qF -- "$EXPECTED"; then
+		echo "PASS $TEXT ${LOCALE}"
+	else
+		echo "FAIL $TEXT ${LOCALE} - got `echo "$SSML" | tr -d "\n"`"
+		FAILED=1
+	fi
+done <<'TABLE'
+2464 mi|2464 miles
+1 mi|1 mile
+5 miles|5 miles
+1.2×10^6 kg|1.2 million kilograms
+1.23×10^7 people|12.3 million people
+6.02×10^23|6.02 times ten to the power of 23
+3.2e-5 m|3.2 times ten to the power of minus 5 meters
+25 °C|25 degrees Celsius
+60 mph and 100 km/h|60 miles per hour and 100 kilometers per hour
+45%|45 percent
+5:30 pm EST|<say-as interpret-as="time" format="hms12">5:30pm</say-as> Eastern Standard Time
+17:45|<say-as interpret-as="time" format="hms24">17:45</say-as>
+2024-03-05|<say-as interpret-as="date" format="ymd">2024-03-05</say-as>
+03/05/2024|<say-as interpret-as="date" format="mdy">03/05/2024</say-as>
+Mar 5, 2024|March 5, 2024
+$1,234.56|1,234 dollars and 56 cents
+$1|1 dollar
+£2.05|2 pounds and 5 pence
+$3.5 billion|3.5 billion dollars
+5 EUR|5 euros
+approx. 7 e.g. this|approximately 7 for example this
+~5 kg|about 5 kilograms
+R&D costs|R&amp;D costs
+5:30 pm est|<say-as interpret-as="time" format="hms12">5:30pm</say-as> Eastern Standard Time
+$5, or $6|5 dollars, or 6 dollars
+12 km, 5 km|12 kilometers, 5 kilometers
+1,234,567 kg|1,234,567 kilograms
+the 1990s|the 1990s
+the 80s|the 80s
+a 5K run|a 5K run
+5g network|5g network
+10 s|10 seconds
+100 W|100 watts
+5km|5 kilometers
+03/05/2024|<say-as interpret-as="date" format="dmy">03/05/2024</say-as>|en-GB
+12 km|12 kilometres|en-GB
+2 L|2 litres|en-GB
+$5|5 US dollars|en-GB
+£2.05|2 pounds and 5 pence|en-GB
+9:15 am GMT|<say-as interpret-as="time" format="hms12">9:15am</say-as> Greenwich Mean Time|en-GB
+03/05/2024|<say-as interpret-as="date" format="mdy">03/05/2024</say-as>|de-DE
+2024-03-05|<say-as interpret-as="date" format="ymd">2024-03-05</say-as>|de-DE
+17:45|<say-as interpret-as="time" format="hms24">17:45</say-as>|de-DE
+12 km|12 km|de-DE
+TABLE
+
+rm -f input
+exit $FAILED
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The offline engine is any command line synthesiser that reads text on stdin and writes a wav file,
+// either to {file} or to stdout, e.g.
+// TTS_OFFLINE_COMMAND="espeak-ng -m -v en-us -w {file} --stdin" with TTS_OFFLINE_INPUT=ssml, or
+// TTS_OFFLINE_COMMAND="piper --model /voices/en_GB-alba-medium.onnx --output_file {file}"
+
+var (
+	ttsOfflineCommand = EnvString("TTS_OFFLINE_COMMAND", "")
+	ttsOfflineInput   = EnvString("TTS_OFFLINE_INPUT", "text") // ssml for engines that understand it
+	ttsOfflineTimeout = EnvDuration("TTS_OFFLINE_TIMEOUT", 2*time.Minute)
+	riffFormat        = regexp.MustCompile(`^riff-(\d+)(khz|hz)-16bit-mono-pcm$`)
+)
+
+type offlineSynthesizer struct {
+	command []string
+	input   string
+	timeout time.Duration
+}
+
+func NewOfflineSynthesizer() SpeechSynthesizer {
+	if ttsOfflineCommand == "" {
+		println("No TTS_OFFLINE_COMMAND configured for the offline backend, e.g. espeak-ng -v en-us -w {file} --stdin")
+		os.Exit(1)
+	}
+	if ttsOfflineInput != "text" && ttsOfflineInput != "ssml" {
+		println("Unknown TTS_OFFLINE_INPUT '" + ttsOfflineInput + "' - Choose text or ssml")
+		os.Exit(1)
+	}
+	return offlineSynthesizer{command: strings.Fields(ttsOfflineCommand), input: ttsOfflineInput, timeout: ttsOfflineTimeout}
+}
+
+func (offline offlineSynthesizer) Synthesize(textSSML []byte, format string) ([]byte, string, error, int) {
+	sampleRate, err := RiffSampleRate(format) // engines only write wav, which is resampled to the format
+	if err != nil {
+		return nil, "local", err, http.StatusNotImplemented
+	}
+
+	input := textSSML
+	if offline.input == "text" {
+		answerText, err := SSMLText(textSSML)
+		if err != nil {
+			return nil, "local", err, http.StatusBadRequest
+		}
+		input = []byte(answerText)
+	}
+
+	speechFile, err := ioutil.TempFile("", "tts-*.wav")
+	if err != nil {
+		return nil, "local", err, http.StatusInternalServerError
+	}
+	speechFile.Close()
+	defer os.Remove(speechFile.Name())
+
+	args := make([]string, len(offline.command))
+	for i, arg := range offline.command {
+		args[i] = strings.ReplaceAll(arg, "{file}", speechFile.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), offline.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	engine := exec.CommandContext(ctx, args[0], args[1:]...)
+	engine.Stdin = bytes.NewReader(input)
+	engine.Stdout, engine.Stderr = &stdout, &stderr
+	if err = engine.Run(); err != nil {
+		err = errors.New("The offline text-to-speech engine failed: " + err.Error() + " " + strings.TrimSpace(stderr.String()))
+		return nil, "local", err, http.StatusInternalServerError
+	}
+
+	engineSpeech, err := ioutil.ReadFile(speechFile.Name())
+	if err != nil || len(engineSpeech) == 0 {
+		engineSpeech = stdout.Bytes() // the engine wrote the wav to stdout instead
+	}
+
+	wav, err := ParseWAV(engineSpeech)
+	if err == nil {
+		wav, err = wav.Convert(sampleRate, 1) // engines use their own sample rate, e.g. 22050Hz
+	}
+	if err != nil {
+		err = errors.New("The offline text-to-speech engine did not produce usable audio: " + err.Error())
+		return nil, "local", err, http.StatusInternalServerError
+	}
+
+	return wav.Bytes(), "local", nil, 0
+}
+
+// RiffSampleRate reads the sample rate of a mono 16-bit riff output format such as riff-16khz-16bit-mono-pcm
+func RiffSampleRate(format string) (uint32, error) {
+	match := riffFormat.FindStringSubmatch(format)
+	if match == nil {
+		return 0, errors.New("The output format " + format + " is not supported by the offline text-to-speech backend")
+	}
+	rate, _ := strconv.Atoi(match[1])
+	if match[2] == "khz" {
+		rate *= 1000
+	}
+	return uint32(rate), nil
+}
+
+// SSMLText extracts the words to be spoken from an SSML document.
+func SSMLText(textSSML []byte) (string, error) {
+	words := []string{}
+	decoder := xml.NewDecoder(bytes.NewReader(textSSML))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if text, ok := token.(xml.CharData); ok && strings.TrimSpace(string(text)) != "" {
+			words = append(words, strings.TrimSpace(string(text)))
+		}
+	}
+	return strings.Join(words, " "), nil
+}
@@ -0,0 +1,48 @@
+#!/bin/sh
+# Checks the offline backend with cat standing in for the synthesiser, printing whatever engine.wav
+# this script writes, start tts with it first:
+#   TTS_BACKEND=offline TTS_OFFLINE_COMMAND="cat engine.wav" go run tts.go ...
+FAILED=0
+DATA=$((`wc -c < speech.wav` - 44)) # speech.wav is 16kHz mono
+
+le() { # le <bytes> <number> writes the number little endian
+	n=$2
+	for i in `seq $1`; do
+		printf "\\`printf %03o $((n % 256))`"
+		n=$((n / 256))
+	done
+}
+
+field() { # field <offset> <bytes> prints the little endian number at the offset of the speech
+	od -An -t u$2 -j $1 -N $2 speech | tr -d ' '
+}
+
+check() { # check <description> <json request> <expected status> <expected text> [<sample rate> <data bytes>]
+	echo "$2" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3003/tts`
+	grep -o '"speech":"[^"]*"' output | cut -d '"' -f4 | base64 -d > speech 2>/dev/null
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output &&
+		{ [ -z "$5" ] || [ "`field 24 4`" = "$5" -a "`field 40 4`" = "$6" -a "`field 22 2`" = "1" -a "`wc -c < speech`" = "$(($6 + 44))" ]; }; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output` rate `field 24 4` data `field 40 4`"
+		FAILED=1
+	fi
+}
+
+cp speech.wav engine.wav
+check "engine rate kept" '{"text":"Hello"}' 200 '"region":"local"' 16000 $DATA
+check "upsampled to 24kHz" '{"text":"Hello","format":"riff-24khz-16bit-mono-pcm"}' 200 '"mimeType":"audio/wav"' 24000 $((DATA * 3 / 2))
+check "downsampled to 8kHz" '{"text":"Hello","format":"riff-8khz-16bit-mono-pcm"}' 200 '"mimeType":"audio/wav"' 8000 $((DATA / 2))
+check "compressed formats" '{"text":"Hello","format":"audio-16khz-32kbitrate-mono-mp3"}' 501 "not supported by the offline text-to-speech backend"
+
+# the same samples read as 22050Hz stereo, mixed down to mono and resampled
+{ printf RIFF; le 4 $((36 + DATA)); printf WAVEfmt; printf " "; le 4 16; le 2 1; le 2 2; le 4 22050; le 4 88200; le 2 4; le 2 16
+	printf data; le 4 $DATA; tail -c +45 speech.wav; } > engine.wav
+check "stereo mixed down" '{"text":"Hello"}' 200 '"region":"local"' 16000 $((DATA / 4 * 16000 / 22050 * 2))
+
+printf "not a wav" > engine.wav
+check "unusable engine output" '{"text":"Hello"}' 500 "did not produce usable audio"
+
+rm -f input output speech engine.wav
+exit $FAILED
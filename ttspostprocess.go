@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Synthesised speech can be adjusted locally before it is returned, without another call to azure:
+// normalised to a target loudness, faded in and out, preceded by a chime and padded with silence.
+// The deployment defaults apply to every 16-bit pcm answer, and a request may override them with
+//
+//	"postProcessing": {"loudness": -16, "padStart": 250, "padEnd": 500, "chime": true, "fadeIn": 20, "fadeOut": 50}
+//
+// giving the loudness in LUFS and the durations in milliseconds.
+
+var (
+	defaultLoudness = EnvFloat("TTS_LOUDNESS", 0) // LUFS, 0 leaves the level as synthesised
+	defaultPadStart = EnvDuration("TTS_PAD_START", 0)
+	defaultPadEnd   = EnvDuration("TTS_PAD_END", 0)
+	defaultFadeIn   = EnvDuration("TTS_FADE_IN", 0)
+	defaultFadeOut  = EnvDuration("TTS_FADE_OUT", 0)
+	chimeFile       = EnvString("TTS_CHIME", "") // 16-bit pcm wav played before answers, none when unset
+	defaultChime    = EnvBool("TTS_CHIME_DEFAULT", false)
+)
+
+const (
+	LOUDNESS_MIN = -70.0 // quieter than the absolute gate of BS.1770
+	LOUDNESS_MAX = -5.0
+	PAD_MAX      = 10 * time.Second
+	FADE_MAX     = 5 * time.Second
+)
+
+type postProcessing struct {
+	Loudness float64       // target integrated loudness in LUFS, 0 to leave the level unchanged
+	PadStart time.Duration // silence before the answer, including the chime
+	PadEnd   time.Duration // silence after the answer
+	Chime    bool          // play the TTS_CHIME wav before the answer
+	FadeIn   time.Duration
+	FadeOut  time.Duration
+}
+
+var chime *WAV // loaded by main, nil when there is no chime
+
+func MustLoadChime(path string) *WAV {
+	if path == "" {
+		return nil
+	}
+
+	chimeBytes, err := ioutil.ReadFile(path)
+	if err == nil {
+		chime, err = ParseWAV(chimeBytes)
+	}
+	if err == nil && (chime.AudioFormat != 1 || chime.BitsPerSample != 16) {
+		err = errors.New("the chime must be 16-bit PCM")
+	}
+	if err != nil {
+		println("Could not load the chime from " + path + " - " + err.Error())
+		os.Exit(1)
+	}
+	return chime
+}
+
+// PostProcessing reads the optional postProcessing field of a /tts request, returning nil when the
+// answer is left as synthesised.
+func PostProcessing(t map[string]interface{}, format string) (*postProcessing, error, int) {
+	processing := &postProcessing{Loudness: defaultLoudness, PadStart: defaultPadStart, PadEnd: defaultPadEnd,
+		Chime: defaultChime && chime != nil, FadeIn: defaultFadeIn, FadeOut: defaultFadeOut}
+
+	field, present := t["postProcessing"]
+	if !present {
+		if *processing == (postProcessing{}) || !PostProcessable(format) { // the defaults only apply where they can
+			return nil, nil, 0
+		}
+		return processing, nil, 0
+	}
+
+	options, ok := field.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Field 'postProcessing' must be an object"), http.StatusBadRequest
+	}
+	if !PostProcessable(format) {
+		return nil, errors.New("Post-processing needs a 16-bit pcm format such as riff-24khz-16bit-mono-pcm, not " + format),
+			http.StatusBadRequest
+	}
+
+	if loudness, present := options["loudness"]; present {
+		if processing.Loudness, ok = loudness.(float64); !ok || processing.Loudness < LOUDNESS_MIN || processing.Loudness > LOUDNESS_MAX {
+			return nil, fmt.Errorf("Field 'loudness' must be between %g and %g LUFS", LOUDNESS_MIN, LOUDNESS_MAX), http.StatusBadRequest
+		}
+	}
+	if useChime, present := options["chime"]; present {
+		if processing.Chime, ok = useChime.(bool); !ok {
+			return nil, errors.New("Field 'chime' must be true or false"), http.StatusBadRequest
+		}
+		if processing.Chime && chime == nil {
+			return nil, errors.New("No chime is configured - Set TTS_CHIME to a wav file"), http.StatusBadRequest
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value *time.Duration
+		max   time.Duration
+	}{
+		{"padStart", &processing.PadStart, PAD_MAX}, {"padEnd", &processing.PadEnd, PAD_MAX},
+		{"fadeIn", &processing.FadeIn, FADE_MAX}, {"fadeOut", &processing.FadeOut, FADE_MAX},
+	}
+	for _, duration := range durations {
+		value, present := options[duration.name]
+		if !present {
+			continue
+		}
+		milliseconds, ok := value.(float64)
+		if !ok || milliseconds < 0 || milliseconds > float64(duration.max/time.Millisecond) {
+			return nil, fmt.Errorf("Field '%s' must be between 0 and %d milliseconds", duration.name, duration.max/time.Millisecond),
+				http.StatusBadRequest
+		}
+		*duration.value = time.Duration(milliseconds * float64(time.Millisecond))
+	}
+
+	return processing, nil, 0
+}
+
+// PostProcessable formats are the 16-bit pcm wavs, not mu-law, a-law, raw or compressed audio.
+func PostProcessable(format string) bool {
+	return strings.HasPrefix(format, "riff-") && strings.HasSuffix(format, "-16bit-mono-pcm")
+}
+
+// PostProcess applies the processing to synthesised speech, returning the adjusted wav.
+func PostProcess(speech []byte, processing *postProcessing) ([]byte, error, int) {
+	if processing == nil {
+		return speech, nil, 0
+	}
+
+	wav, err := ParseWAV(speech)
+	if err != nil {
+		return nil, errors.New("The synthesised speech could not be post-processed - " + err.Error()), http.StatusBadGateway
+	}
+
+	samples := wav.Samples()
+	if processing.Loudness != 0 {
+		measured := IntegratedLoudness(samples, int(wav.Channels), float64(wav.SampleRate))
+		if !math.IsInf(measured, -1) { // silence can't be brought up to any level
+			gain := math.Pow(10, (processing.Loudness-measured)/20)
+			if peak := Peak(samples); peak*gain > 1 {
+				gain = 1 / peak // stop short of clipping rather than distort the answer
+			}
+			for i := range samples {
+				samples[i] *= gain
+			}
+			println(fmt.Sprintf("Normalized loudness from %.1f to %.1f LUFS", measured, measured+20*math.Log10(gain)))
+		}
+	}
+	Fade(samples, int(wav.Channels), int(wav.SampleRate), processing.FadeIn, processing.FadeOut)
+	wav.SetSamples(samples)
+
+	parts := []*WAV{Silence(wav, processing.PadStart)}
+	if processing.Chime {
+		converted, err := chime.Convert(wav.SampleRate, wav.Channels)
+		if err != nil {
+			return nil, err, http.StatusInternalServerError
+		}
+		parts = append(parts, converted)
+	}
+	parts = append(parts, wav, Silence(wav, processing.PadEnd))
+
+	processed, err := ConcatWAV(parts)
+	if err != nil {
+		return nil, err, http.StatusInternalServerError
+	}
+	return processed.Bytes(), nil, 0
+}
+
+// IntegratedLoudness measures the loudness of the samples in LUFS as ITU-R BS.1770 does: K-weighted,
+// in 400ms blocks overlapping by 75%, ignoring blocks below -70 LUFS and then those more than 10 LU
+// below the loudness of the rest. It is -Inf for silence.
+func IntegratedLoudness(samples []float64, channels int, sampleRate float64) float64 {
+	frames := len(samples) / channels
+	power := make([]float64, frames) // K-weighted power of each frame, summed over the channels
+	for c := 0; c < channels; c++ {
+		shelf, highPass := KWeighting(sampleRate)
+		for i := 0; i < frames; i++ {
+			weighted := highPass.Filter(shelf.Filter(samples[i*channels+c]))
+			power[i] += weighted * weighted
+		}
+	}
+
+	block, step := int(0.4*sampleRate), int(0.1*sampleRate)
+	if frames < block { // answers shorter than a block are measured as one
+		block = frames
+	}
+	blocks := []float64{}
+	for start := 0; start+block <= frames && block > 0; start += step {
+		sum := 0.0
+		for _, p := range power[start : start+block] {
+			sum += p
+		}
+		blocks = append(blocks, sum/float64(block))
+	}
+
+	GatedLoudness := func(threshold float64) float64 {
+		sum, count := 0.0, 0
+		for _, meanSquare := range blocks {
+			if BlockLoudness(meanSquare) > threshold {
+				sum += meanSquare
+				count++
+			}
+		}
+		if count == 0 {
+			return math.Inf(-1)
+		}
+		return BlockLoudness(sum / float64(count))
+	}
+
+	relative := GatedLoudness(-70) - 10
+	return GatedLoudness(math.Max(-70, relative))
+}
+
+func BlockLoudness(meanSquare float64) float64 {
+	return -0.691 + 10*math.Log10(meanSquare)
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) Filter(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1, f.y2, f.y1 = f.x1, x, f.y1, y
+	return y
+}
+
+// KWeighting is the two stage filter of BS.1770, a high shelf modelling the head followed by a high
+// pass, with coefficients derived for the sample rate rather than only the 48kHz ones in the standard.
+func KWeighting(sampleRate float64) (*biquad, *biquad) {
+	k := math.Tan(math.Pi * 1681.974450955533 / sampleRate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := &biquad{b0: (vh + vb*k/q + k*k) / a0, b1: 2 * (k*k - vh) / a0, b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0, a2: (1 - k/q + k*k) / a0}
+
+	k = math.Tan(math.Pi * 38.13547087602444 / sampleRate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := &biquad{b0: 1, b1: -2, b2: 1, a1: 2 * (k*k - 1) / a0, a2: (1 - k/q + k*k) / a0}
+
+	return shelf, highPass
+}
+
+func Peak(samples []float64) float64 {
+	peak := 0.0
+	for _, sample := range samples {
+		peak = math.Max(peak, math.Abs(sample))
+	}
+	return peak
+}
+
+// Fade ramps the level up from silence at the start and down to silence at the end.
+func Fade(samples []float64, channels, sampleRate int, fadeIn, fadeOut time.Duration) {
+	frames := len(samples) / channels
+	inFrames := int(fadeIn * time.Duration(sampleRate) / time.Second)
+	outFrames := int(fadeOut * time.Duration(sampleRate) / time.Second)
+	for i := 0; i < frames; i++ {
+		gain := 1.0
+		if i < inFrames {
+			gain = float64(i) / float64(inFrames)
+		}
+		if remaining := frames - 1 - i; remaining < outFrames {
+			gain = math.Min(gain, float64(remaining)/float64(outFrames))
+		}
+		for c := 0; c < channels; c++ {
+			samples[i*channels+c] *= gain
+		}
+	}
+}
+
+// Silence is a wav of the duration in the same format as the given one.
+func Silence(format *WAV, duration time.Duration) *WAV {
+	silence := *format
+	silence.Data = make([]byte, int(duration*time.Duration(format.SampleRate)/time.Second)*format.BlockAlign())
+	return &silence
+}
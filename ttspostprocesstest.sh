@@ -0,0 +1,74 @@
+#!/bin/sh
+# Checks the post-processing of synthesised answers against the local stand-in, which speaks a 440Hz
+# tone for 60ms per character. Start the stand-in and tts with speech.wav as the chime first:
+#   go run azurestub.go
+#   export SPEECH_KEY=stub SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken
+#   TTS_CHIME=speech.wav TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 go run tts.go ...
+FAILED=0
+CHIME=$((`wc -c < speech.wav` - 44))
+
+request() { # request <json request> saves the decoded speech and prints the status
+	echo "$1" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3003/tts`
+	grep -o '"speech":"[^"]*"' output | cut -d '"' -f4 | base64 -d > speech 2>/dev/null
+	echo $STATUS
+}
+
+check() { # check <description> <json request> <expected status> <expected text in response>
+	STATUS=`request "$2"`
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+check_size() { # check_size <description> <json request> <expected number of bytes added to the plain answer>
+	STATUS=`request "$2"`
+	SIZE=`wc -c < speech`
+	if [ "$STATUS" = "200" ] && [ "$SIZE" = "$((PLAIN + $3))" ]; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS with $SIZE bytes, expected $((PLAIN + $3)) `head -c 300 output`"
+		FAILED=1
+	fi
+}
+
+level() { # level <first sample> <samples> prints the root mean square of the samples of the speech
+	od -An -v -t d2 -j $((44 + 2 * $1)) -N $((2 * $2)) speech |
+		awk '{ for (i = 1; i <= NF; i++) { sum += $i * $i; n++ } } END { printf "%d", sqrt(sum / n) }'
+}
+
+request '{"text":"Hello there"}' > /dev/null
+PLAIN=`wc -c < speech`
+check_size "silence padding" '{"text":"Hello there","postProcessing":{"padStart":500,"padEnd":250}}' $((16000 * 2 * 3 / 4))
+check_size "chime before the answer" '{"text":"Hello there","postProcessing":{"chime":true}}' $CHIME
+check_size "chime after the padding" '{"text":"Hello there","postProcessing":{"chime":true,"padStart":100}}' $((CHIME + 3200))
+check "ssml is post-processed" '{"ssml":"<speak version=\"1.0\" xml:lang=\"en-US\"><voice name=\"en-US-JennyNeural\">Hello there</voice></speak>","postProcessing":{"padEnd":1000}}' 200 '"region"'
+[ "`wc -c < speech`" = "$((PLAIN + 32000))" ] && echo "PASS ssml padded" || { echo "FAIL ssml padding"; FAILED=1; }
+
+request '{"text":"Hello there","postProcessing":{"fadeIn":200,"fadeOut":200}}' > /dev/null
+FRAMES=$(((`wc -c < speech` - 44) / 2))
+START=`level 0 320`; MIDDLE=`level 3200 320`; END=`level $((FRAMES - 320)) 320`
+[ "$START" -lt $((MIDDLE / 5)) ] && [ "$END" -lt $((MIDDLE / 5)) ] && echo "PASS fades" ||
+	{ echo "FAIL fades - levels $START, $MIDDLE and $END"; FAILED=1; }
+
+request '{"text":"Hello there","postProcessing":{"loudness":-16}}' > /dev/null
+LOUD=`level 0 8000`
+request '{"text":"Hello there","postProcessing":{"loudness":-26}}' > /dev/null
+QUIET=`level 0 8000`
+[ $((LOUD * 100 / QUIET)) -ge 310 ] && [ $((LOUD * 100 / QUIET)) -le 322 ] && echo "PASS 10 LU louder" ||
+	{ echo "FAIL loudness - levels $LOUD and $QUIET"; FAILED=1; }
+request '{"text":"Hello there","postProcessing":{"loudness":-5}}' > /dev/null
+[ "`od -An -v -t d2 -j 44 speech | tr ' ' '\n' | grep -c -- '-32768\|32767'`" -lt 100 ] && echo "PASS loud targets don't clip" ||
+	{ echo "FAIL clipped"; FAILED=1; }
+
+check "compressed formats" '{"text":"Hello","format":"audio-16khz-32kbitrate-mono-mp3","postProcessing":{"padEnd":100}}' 400 "needs a 16-bit pcm format"
+check "loudness range" '{"text":"Hello","postProcessing":{"loudness":3}}' 400 "between -70 and -5 LUFS"
+check "negative padding" '{"text":"Hello","postProcessing":{"padStart":-5}}' 400 "'padStart' must be between 0 and 10000 milliseconds"
+check "chime must be a bool" '{"text":"Hello","postProcessing":{"chime":"yes"}}' 400 "must be true or false"
+check "postProcessing must be an object" '{"text":"Hello","postProcessing":true}' 400 "must be an object"
+
+rm -f input output speech
+exit $FAILED
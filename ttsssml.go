@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Requests may send their own SSML in place of text, e.g. to add breaks, emphasis or phonemes. It is
+// sent to microsoft as it is, without spoken form normalisation, once it has been checked here so
+// malformed or unsupported markup is reported to the caller rather than as a bare 400 from azure.
+
+var (
+	ssmlMaxBytes = int(EnvFloat("TTS_SSML_MAX_BYTES", 16384))
+	// elements an ssml document may use, microsoft's extensions prefixed with mstts:
+	// audio and lexicon are left out as they make azure fetch urls given by the caller
+	ssmlElements = EnvList("TTS_SSML_ELEMENTS", []string{"speak", "voice", "prosody", "break", "emphasis",
+		"phoneme", "say-as", "sub", "p", "s", "lang", "bookmark", "mstts:express-as", "mstts:silence"})
+)
+
+// CheckSSML validates an ssml document against the allowed elements and the voice catalog.
+func CheckSSML(textSSML string) (error, int) {
+	if len(textSSML) > ssmlMaxBytes {
+		return errors.New("The ssml is " + strconv.Itoa(len(textSSML)) + " bytes, the limit is " + strconv.Itoa(ssmlMaxBytes)),
+			http.StatusRequestEntityTooLarge
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(textSSML))
+	SSMLErr := func(message string) (error, int) {
+		line, column := decoder.InputPos()
+		return errors.New("Invalid ssml at line " + strconv.Itoa(line) + ", column " + strconv.Itoa(column) + " - " + message),
+			http.StatusBadRequest
+	}
+
+	depth, roots, voices, inVoice := 0, 0, 0, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+				return SSMLErr(syntaxErr.Msg)
+			}
+			return SSMLErr(err.Error())
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			name := SSMLName(token.Name)
+			if depth == 0 && name != "speak" {
+				return SSMLErr("the root element must be <speak>, not <" + name + ">")
+			}
+			if depth == 0 && roots > 0 {
+				return SSMLErr("the document can only have one <speak> root element")
+			}
+			if depth > 0 && name == "speak" {
+				return SSMLErr("<speak> can only be the root element")
+			}
+			if !Contains(ssmlElements, name) {
+				return SSMLErr("the element <" + name + "> is not allowed - Use " + strings.Join(ssmlElements, ", "))
+			}
+			if err := CheckSSMLAttrs(name, token.Attr); err != "" {
+				return SSMLErr(err)
+			}
+			if name == "voice" {
+				if inVoice > 0 {
+					return SSMLErr("<voice> elements can't be nested")
+				}
+				if !HasAttr(token.Attr, "name") {
+					return SSMLErr("<voice> needs the name of a voice")
+				}
+				voices++
+				inVoice++
+			}
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			if SSMLName(token.Name) == "voice" {
+				inVoice--
+			}
+			depth--
+		case xml.CharData:
+			if inVoice == 0 && len(bytes.TrimSpace(token)) > 0 {
+				return SSMLErr("text must be inside a <voice> element")
+			}
+		case xml.Directive:
+			return SSMLErr("directives such as <!DOCTYPE> are not allowed")
+		}
+	}
+
+	if depth != 0 || voices == 0 {
+		return SSMLErr("the document needs a <speak> element holding at least one <voice>")
+	}
+	return nil, 0
+}
+
+// SSMLName names an element the way the allowlist does, e.g. mstts:express-as
+func SSMLName(name xml.Name) string {
+	switch name.Space {
+	case MSTTS_NAMESPACE, "mstts": // the prefix is left as it is when the namespace isn't declared
+		return "mstts:" + name.Local
+	case "", SSML_NAMESPACE:
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// CheckSSMLAttrs checks the attributes that choose voices, styles and prosody, returning a message
+// describing the first invalid one.
+func CheckSSMLAttrs(name string, attrs []xml.Attr) string {
+	for _, attr := range attrs {
+		value := attr.Value
+		switch name + " " + attr.Name.Local {
+		case "voice name":
+			if !catalog.Has(value) {
+				return "the voice '" + value + "' is not in the catalog - See GET /tts/voices"
+			}
+		case "mstts:express-as style":
+			if !Contains(speakingStyles, value) {
+				return "the style '" + value + "' is not supported"
+			}
+		case "mstts:express-as role":
+			if !Contains(roles, value) {
+				return "the role '" + value + "' is not supported"
+			}
+		case "mstts:express-as styledegree":
+			if degree, err := strconv.ParseFloat(value, 64); err != nil || degree < 0.01 || degree > 2 {
+				return "styledegree must be between 0.01 and 2"
+			}
+		case "prosody rate":
+			if !ratePattern.MatchString(value) {
+				return "the rate '" + value + "' is not valid"
+			}
+		case "prosody pitch":
+			if !pitchPattern.MatchString(value) {
+				return "the pitch '" + value + "' is not valid"
+			}
+		case "prosody volume":
+			if !volumePattern.MatchString(value) {
+				return "the volume '" + value + "' is not valid"
+			}
+		}
+	}
+	return ""
+}
+
+func HasAttr(attrs []xml.Attr, name string) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
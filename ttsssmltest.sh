@@ -0,0 +1,40 @@
+#!/bin/sh
+# Checks ssml passthrough against the local stand-in, start both services first:
+#   go run azurestub.go
+#   TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run tts.go ...
+FAILED=0
+SPEAK="<speak version='1.0' xmlns='http://www.w3.org/2001/10/synthesis' xmlns:mstts='https://www.w3.org/2001/mstts' xml:lang='en-US'>"
+
+check() { # check <description> <json request> <expected status> <expected text in the ssml or error>
+	printf "%s\n" "$2" > input # printf leaves the \n escapes for the json
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3003/tts`
+	[ "$STATUS" = "200" ] && curl -s localhost:3010/stub/ssml > output
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `cat output | tr -d "\n"`"
+		FAILED=1
+	fi
+}
+
+check "passed through" "{\"ssml\":\"$SPEAK<voice name='en-US-GuyNeural'>Wait<break time='500ms'/> for it</voice></speak>\"}" 200 "Wait<break time='500ms'/> for it"
+check "styles and phonemes" "{\"ssml\":\"$SPEAK<voice name='en-GB-RyanNeural'><mstts:express-as style='cheerful'><phoneme alphabet='ipa' ph='təˈmɑːtəʊ'>tomato</phoneme></mstts:express-as></voice></speak>\"}" 200 "ph='təˈmɑːtəʊ'"
+check "malformed markup" "{\"ssml\":\"$SPEAK\\n<voice name='en-US-GuyNeural'>\\nHello</prosody></voice></speak>\"}" 400 "line 3, column 16"
+check "element not allowed" "{\"ssml\":\"$SPEAK<voice name='en-US-GuyNeural'><audio src='http://example.com/a.wav'/></voice></speak>\"}" 400 "element <audio> is not allowed"
+check "voice not in the catalog" "{\"ssml\":\"$SPEAK<voice name='en-US-DavisNeural'>Hello</voice></speak>\"}" 400 "is not in the catalog"
+check "voice without a name" "{\"ssml\":\"$SPEAK<voice>Hello</voice></speak>\"}" 400 "needs the name of a voice"
+check "text outside a voice" "{\"ssml\":\"${SPEAK}Hello</speak>\"}" 400 "text must be inside a <voice>"
+check "no voice" "{\"ssml\":\"$SPEAK</speak>\"}" 400 "at least one <voice>"
+check "root must be speak" "{\"ssml\":\"<voice name='en-US-GuyNeural'>Hello</voice>\"}" 400 "root element must be <speak>"
+check "second root" "{\"ssml\":\"$SPEAK<voice name='en-US-GuyNeural'>Hello</voice></speak>$SPEAK<voice name='en-US-GuyNeural'>Again</voice></speak>\"}" 400 "only have one <speak> root"
+check "invalid prosody" "{\"ssml\":\"$SPEAK<voice name='en-US-GuyNeural'><prosody rate='ludicrous'>Hello</prosody></voice></speak>\"}" 400 "rate 'ludicrous' is not valid"
+check "unknown style" "{\"ssml\":\"$SPEAK<voice name='en-US-GuyNeural'><mstts:express-as style='grumpy'>Hello</mstts:express-as></voice></speak>\"}" 400 "style 'grumpy' is not supported"
+check "text and ssml together" "{\"text\":\"Hello\",\"ssml\":\"$SPEAK<voice name='en-US-GuyNeural'>Hello</voice></speak>\"}" 400 "can't be combined with 'ssml'"
+check "empty ssml" "{\"ssml\":\"\"}" 400 "non-empty string"
+
+LONG=`head -c 20000 /dev/zero | tr '\0' 'a'`
+check "size limit" "{\"ssml\":\"$SPEAK<voice name='en-US-GuyNeural'>$LONG</voice></speak>\"}" 413 "the limit is"
+
+rm -f input output
+exit $FAILED
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+)
+
+// SpeechSynthesizer speaks an SSML document, returning the audio in the output format and where it
+// was synthesised, such as the azure region.
+type SpeechSynthesizer interface {
+	Synthesize(textSSML []byte, format string) ([]byte, string, error, int)
+}
+
+var synthesizer SpeechSynthesizer // chosen by main
+
+// NewSynthesizer picks the backend named by TTS_BACKEND, exiting if it can't be set up.
+func NewSynthesizer(backend string) SpeechSynthesizer {
+	switch backend {
+	case "azure":
+		speechKey = MustLoadSecret("SPEECH_KEY") // fail fast rather than on the first request
+		return azureSynthesizer{}
+	case "offline":
+		return NewOfflineSynthesizer()
+	}
+
+	println("Unknown TTS_BACKEND '" + backend + "' - Choose azure or offline")
+	os.Exit(1)
+	return nil
+}
+
+// azureSynthesizer uses the microsoft text-to-speech rest api.
+type azureSynthesizer struct{}
+
+func (azureSynthesizer) Synthesize(textSSML []byte, format string) ([]byte, string, error, int) {
+	return TextToSpeech(textSSML, format)
+}
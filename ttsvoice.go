@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// TTS_VOICES are preferred when choosing a voice for a locale, and are the catalog until azure's list is fetched
+	configuredVoices = EnvList("TTS_VOICES", []string{"en-US-JennyNeural", "en-US-GuyNeural", "en-US-AriaNeural",
+		"en-GB-SoniaNeural", "en-GB-RyanNeural", "en-AU-NatashaNeural", "en-IE-EmilyNeural"})
+	defaultVoice  = EnvString("TTS_VOICE", "en-US-JennyNeural")
+	defaultLocale = EnvString("TTS_LOCALE", "") // the locale of the voice when empty
+	defaultRate   = EnvString("TTS_RATE", "")   // empty leaves the voice's own prosody
+	defaultPitch  = EnvString("TTS_PITCH", "")
+	defaultVolume = EnvString("TTS_VOLUME", "")
+	defaultStyle  = EnvString("TTS_STYLE", "") // empty for the voice's neutral style
+	defaultDegree = EnvFloat("TTS_STYLE_DEGREE", 0)
+	defaultRole   = EnvString("TTS_ROLE", "")
+)
+
+var (
+	// the speaking styles of microsoft's neural voices, each voice supports some of them
+	speakingStyles = []string{"advertisement_upbeat", "affectionate", "angry", "assistant", "calm", "chat", "cheerful",
+		"customerservice", "depressed", "disgruntled", "documentary-narration", "embarrassed", "empathetic", "envious",
+		"excited", "fearful", "friendly", "gentle", "hopeful", "lyrical", "narration-professional", "narration-relaxed",
+		"newscast", "newscast-casual", "newscast-formal", "poetry-reading", "sad", "serious", "shouting", "sports_commentary",
+		"sports_commentary_excited", "whispering", "terrified", "unfriendly"}
+	roles = []string{"Girl", "Boy", "YoungAdultFemale", "YoungAdultMale", "OlderAdultFemale", "OlderAdultMale",
+		"SeniorFemale", "SeniorMale"}
+)
+
+// the values azure accepts for each prosody attribute, as words, relative changes or absolute values
+var (
+	ratePattern   = regexp.MustCompile(`^(x-slow|slow|medium|fast|x-fast|default|[-+]?\d+(\.\d+)?%|\d+(\.\d+)?)$`)
+	pitchPattern  = regexp.MustCompile(`^(x-low|low|medium|high|x-high|default|[-+]?\d+(\.\d+)?(%|Hz|st)|\d+(\.\d+)?Hz)$`)
+	volumePattern = regexp.MustCompile(`^(silent|x-soft|soft|medium|loud|x-loud|default|[-+]?\d+(\.\d+)?%|\d+(\.\d+)?)$`)
+)
+
+type voiceOptions struct {
+	Voice  string  // a voice from the catalog, e.g. en-GB-SoniaNeural
+	Locale string  // language of the text, e.g. en-GB
+	Rate   string  // e.g. slow, +10% or 1.2
+	Pitch  string  // e.g. high, -5%, +2st or 180Hz
+	Volume string  // e.g. loud, -20% or 80
+	Style  string  // speaking style such as cheerful or empathetic
+	Degree float64 // intensity of the style from 0.01 to 2, 0 for the voice's default of 1
+	Role   string  // age and gender the voice imitates, e.g. OlderAdultMale
+}
+
+// MustCheckDefaultProsody exits at startup rather than failing every request with a mistyped TTS_RATE,
+// TTS_PITCH, TTS_VOLUME, TTS_STYLE, TTS_STYLE_DEGREE or TTS_ROLE. The voice is still checked per request,
+// as the catalog it must be in is refreshed while the service runs.
+func MustCheckDefaultProsody() {
+	options := voiceOptions{Rate: defaultRate, Pitch: defaultPitch, Volume: defaultVolume,
+		Style: defaultStyle, Degree: defaultDegree, Role: defaultRole}
+	if err, _ := CheckProsody(&options); err != nil {
+		println("Invalid default voice settings - " + err.Error())
+		os.Exit(1)
+	}
+}
+
+// VoiceOptions reads the optional voice and prosody fields of a /tts request, using the deployment
+// defaults for any that are absent.
+func VoiceOptions(t map[string]interface{}) (voiceOptions, error, int) {
+	options := voiceOptions{Rate: defaultRate, Pitch: defaultPitch, Volume: defaultVolume,
+		Style: defaultStyle, Degree: defaultDegree, Role: defaultRole}
+
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"voice", &options.Voice}, {"locale", &options.Locale},
+		{"rate", &options.Rate}, {"pitch", &options.Pitch}, {"volume", &options.Volume},
+		{"style", &options.Style}, {"role", &options.Role},
+	}
+	for _, field := range fields {
+		value, present := t[field.name]
+		if !present {
+			continue
+		}
+		var ok bool
+		if *field.value, ok = value.(string); !ok {
+			return options, errors.New("Field '" + field.name + "' must be a string"), http.StatusBadRequest
+		}
+	}
+	if degree, present := t["styleDegree"]; present {
+		var ok bool
+		if options.Degree, ok = degree.(float64); !ok {
+			return options, errors.New("Field 'styleDegree' must be a number"), http.StatusBadRequest
+		}
+	}
+
+	err, errCode := CheckVoiceOptions(&options)
+	return options, err, errCode
+}
+
+// CheckVoiceOptions validates the options, choosing the voice from the locale or the locale from
+// the voice when only one of them was given.
+func CheckVoiceOptions(options *voiceOptions) (error, int) {
+	switch {
+	case options.Voice != "":
+	case options.Locale != "":
+		if options.Voice = catalog.LocaleVoice(options.Locale); options.Voice == "" {
+			return errors.New("No voice in the catalog speaks the locale '" + options.Locale + "'"), http.StatusBadRequest
+		}
+	default:
+		options.Voice, options.Locale = defaultVoice, defaultLocale
+	}
+
+	if !catalog.Has(options.Voice) {
+		return errors.New("The voice '" + options.Voice + "' is not in the catalog - See GET /tts/voices"), http.StatusBadRequest
+	}
+	if options.Locale != "" && !strings.EqualFold(options.Locale, VoiceLocale(options.Voice)) {
+		return errors.New("The voice '" + options.Voice + "' does not speak the locale '" + options.Locale + "'"),
+			http.StatusBadRequest
+	}
+	options.Locale = VoiceLocale(options.Voice) // the spelling the spoken forms are keyed by, e.g. en-GB
+
+	return CheckProsody(options)
+}
+
+// CheckProsody validates the prosody, style and role options, which don't depend on the voice.
+func CheckProsody(options *voiceOptions) (error, int) {
+	if options.Rate != "" && !ratePattern.MatchString(options.Rate) {
+		return errors.New("The rate '" + options.Rate + "' is not valid - Use x-slow to x-fast, a change such as +10% or a multiple such as 1.2"),
+			http.StatusBadRequest
+	}
+	if options.Pitch != "" && !pitchPattern.MatchString(options.Pitch) {
+		return errors.New("The pitch '" + options.Pitch + "' is not valid - Use x-low to x-high, a change such as -5% or +2st, or a frequency such as 180Hz"),
+			http.StatusBadRequest
+	}
+	if options.Volume != "" && !volumePattern.MatchString(options.Volume) {
+		return errors.New("The volume '" + options.Volume + "' is not valid - Use silent to x-loud, a change such as -20% or a level from 0 to 100"),
+			http.StatusBadRequest
+	}
+
+	if options.Style != "" && !Contains(speakingStyles, options.Style) {
+		return errors.New("The style '" + options.Style + "' is not supported - Choose one of " +
+			strings.Join(speakingStyles, ", ")), http.StatusBadRequest
+	}
+	if options.Degree != 0 && (options.Degree < 0.01 || options.Degree > 2) {
+		return errors.New("Field 'styleDegree' must be between 0.01 and 2"), http.StatusBadRequest
+	}
+	if options.Degree != 0 && options.Style == "" {
+		return errors.New("Field 'styleDegree' needs a 'style' to apply to"), http.StatusBadRequest
+	}
+	if options.Role != "" && !Contains(roles, options.Role) {
+		return errors.New("The role '" + options.Role + "' is not supported - Choose one of " +
+			strings.Join(roles, ", ")), http.StatusBadRequest
+	}
+
+	return nil, 0
+}
+
+// VoiceLocale is the locale at the start of a voice name, e.g. en-GB for en-GB-SoniaNeural.
+func VoiceLocale(voice string) string {
+	parts := strings.SplitN(voice, "-", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[0] + "-" + parts[1]
+}
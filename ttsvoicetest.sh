@@ -0,0 +1,47 @@
+#!/bin/sh
+# Checks the voice and prosody options against the local stand-in, start both services first:
+#   go run azurestub.go
+#   TTS_ENDPOINT=http://localhost:3010/cognitiveservices/v1 \
+#   SPEECH_TOKEN_ENDPOINT=http://localhost:3010/sts/v1.0/issueToken SPEECH_KEY=stub go run tts.go ...
+FAILED=0
+
+check() { # check <description> <extra json fields> <expected status> <expected text in the ssml or error>
+	echo "{\"text\":\"It is 5 km away\"$2}" > input
+	STATUS=`curl -s -o output -w "%{http_code}" -X POST -d @input localhost:3003/tts`
+	[ "$STATUS" = "200" ] && curl -s localhost:3010/stub/ssml > output
+	if [ "$STATUS" = "$3" ] && grep -q -- "$4" output; then
+		echo "PASS $1"
+	else
+		echo "FAIL $1 - got $STATUS `cat output | tr -d "\n"`"
+		FAILED=1
+	fi
+}
+
+check "default voice" "" 200 'name="en-US-JennyNeural"'
+check "no prosody by default" "" 200 '<voice xml:lang="en-US" name="en-US-JennyNeural">It is'
+check "chosen voice" ",\"voice\":\"en-US-GuyNeural\"" 200 'name="en-US-GuyNeural"'
+check "voice from the locale" ",\"locale\":\"en-GB\"" 200 '<voice xml:lang="en-GB" name="en-GB-SoniaNeural">'
+check "locale spellings" ",\"locale\":\"en-GB\"" 200 "5 kilometres"
+check "locale from the voice" ",\"voice\":\"en-AU-NatashaNeural\"" 200 '<voice xml:lang="en-AU" name="en-AU-NatashaNeural">'
+check "prosody" ",\"rate\":\"slow\",\"pitch\":\"+2st\",\"volume\":\"80\"" 200 '<prosody rate="slow" pitch="+2st" volume="80">It is'
+check "relative rate" ",\"rate\":\"-10%\"" 200 '<prosody rate="-10%">'
+check "locale in lower case" ",\"voice\":\"en-US-JennyNeural\",\"locale\":\"en-us\"" 200 '<voice xml:lang="en-US" name="en-US-JennyNeural">'
+check "voice from a lower case locale" ",\"locale\":\"en-gb\"" 200 "5 kilometres"
+check "voice not in the catalog" ",\"voice\":\"en-US-DavisNeural\"" 400 "is not in the catalog"
+check "no voice for the locale" ",\"locale\":\"fr-FR\"" 400 "No voice in the catalog"
+check "voice and locale disagree" ",\"voice\":\"en-US-GuyNeural\",\"locale\":\"en-GB\"" 400 "does not speak the locale"
+check "invalid rate" ",\"rate\":\"very fast\"" 400 "rate 'very fast' is not valid"
+check "invalid pitch" ",\"pitch\":\"+2\"" 400 "pitch '+2' is not valid"
+check "invalid volume" ",\"volume\":\"deafening\"" 400 "volume 'deafening' is not valid"
+check "speaking style" ",\"style\":\"cheerful\"" 200 '<mstts:express-as style="cheerful">It is'
+check "style degree and role" ",\"style\":\"sad\",\"styleDegree\":0.5,\"role\":\"OlderAdultMale\"" 200 'style="sad" styledegree="0.5" role="OlderAdultMale"'
+check "prosody inside the style" ",\"style\":\"calm\",\"rate\":\"slow\"" 200 '<prosody rate="slow">It is'
+check "mstts namespace" "" 200 'xmlns:mstts="https://www.w3.org/2001/mstts"'
+check "unknown style" ",\"style\":\"grumpy\"" 400 "style 'grumpy' is not supported"
+check "style degree out of range" ",\"style\":\"sad\",\"styleDegree\":3" 400 "between 0.01 and 2"
+check "style degree without a style" ",\"styleDegree\":1.5" 400 "needs a 'style'"
+check "unknown role" ",\"role\":\"Robot\"" 400 "role 'Robot' is not supported"
+check "voice must be a string" ",\"voice\":5" 400 "must be a string"
+
+rm -f input output
+exit $FAILED
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// WAV is a decoded RIFF/WAVE file holding the format header and the raw sample data.
+type WAV struct {
+	AudioFormat   uint16 // 1 is linear PCM
+	Channels      uint16
+	SampleRate    uint32
+	BitsPerSample uint16
+	Data          []byte
+}
+
+func ParseWAV(wavBytes []byte) (*WAV, error) {
+	if len(wavBytes) < 12 || string(wavBytes[0:4]) != "RIFF" || string(wavBytes[8:12]) != "WAVE" {
+		return nil, errors.New("Not a valid RIFF/WAVE file!")
+	}
+
+	wav := &WAV{}
+	foundFmt, foundData := false, false
+	pos := 12
+	for pos+8 <= len(wavBytes) && !foundData {
+		chunkID := string(wavBytes[pos : pos+4])
+		chunkSize := int(binary.LittleEndian.Uint32(wavBytes[pos+4 : pos+8]))
+		pos += 8
+		if chunkSize < 0 || pos+chunkSize > len(wavBytes) {
+			chunkSize = len(wavBytes) - pos // streamed files may leave the size unset, so take the rest of the file
+		}
+
+		switch chunkID {
+		case "fmt ":
+			if chunkSize < 16 {
+				return nil, errors.New("The WAV 'fmt ' chunk is too short!")
+			}
+			wav.AudioFormat = binary.LittleEndian.Uint16(wavBytes[pos : pos+2])
+			wav.Channels = binary.LittleEndian.Uint16(wavBytes[pos+2 : pos+4])
+			wav.SampleRate = binary.LittleEndian.Uint32(wavBytes[pos+4 : pos+8])
+			wav.BitsPerSample = binary.LittleEndian.Uint16(wavBytes[pos+14 : pos+16])
+			foundFmt = true
+		case "data":
+			wav.Data = wavBytes[pos : pos+chunkSize]
+			foundData = true
+		}
+
+		pos += chunkSize + chunkSize%2 // chunks are padded to an even number of bytes
+	}
+
+	if !foundFmt || !foundData {
+		return nil, errors.New("The WAV file is missing its 'fmt ' or 'data' chunk!")
+	}
+	if wav.Channels == 0 || wav.SampleRate == 0 || wav.BitsPerSample == 0 {
+		return nil, errors.New("The WAV file has an invalid format header!")
+	}
+
+	return wav, nil
+}
+
+// BlockAlign is the number of bytes in one sample frame across all channels, rounded up to a whole
+// byte so compressed formats such as 4-bit ADPCM never have frames of 0 bytes.
+func (wav *WAV) BlockAlign() int {
+	return (int(wav.Channels)*int(wav.BitsPerSample) + 7) / 8
+}
+
+func (wav *WAV) Frames() int {
+	return len(wav.Data) / wav.BlockAlign()
+}
+
+func (wav *WAV) Duration() time.Duration {
+	return time.Duration(wav.Frames()) * time.Second / time.Duration(wav.SampleRate)
+}
+
+// FrameOffset converts a sample frame index into a time offset from the start of the audio.
+func (wav *WAV) FrameOffset(frame int) time.Duration {
+	return time.Duration(frame) * time.Second / time.Duration(wav.SampleRate)
+}
+
+// Slice returns the frames in [start, end) as a new WAV sharing the same format.
+func (wav *WAV) Slice(start, end int) *WAV {
+	blockAlign := wav.BlockAlign()
+	slice := *wav
+	slice.Data = wav.Data[start*blockAlign : end*blockAlign]
+	return &slice
+}
+
+// Bytes encodes the WAV as a canonical 44 byte header followed by the sample data.
+func (wav *WAV) Bytes() []byte {
+	var buf bytes.Buffer
+	blockAlign := wav.BlockAlign()
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(wav.Data)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, wav.AudioFormat)
+	binary.Write(&buf, binary.LittleEndian, wav.Channels)
+	binary.Write(&buf, binary.LittleEndian, wav.SampleRate)
+	binary.Write(&buf, binary.LittleEndian, uint32(int(wav.SampleRate)*blockAlign)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&buf, binary.LittleEndian, wav.BitsPerSample)
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(wav.Data)))
+	buf.Write(wav.Data)
+	return buf.Bytes()
+}
+
+// Convert resamples 16-bit PCM audio to the given sample rate and channel count, so audio from any
+// source can be returned in the configured output format.
+func (wav *WAV) Convert(sampleRate uint32, channels uint16) (*WAV, error) {
+	if wav.AudioFormat != 1 || wav.BitsPerSample != 16 {
+		return nil, errors.New("Only 16-bit PCM audio can be converted!")
+	}
+	if wav.SampleRate == sampleRate && wav.Channels == channels {
+		return wav, nil
+	}
+
+	// mix down to mono, then resample by linear interpolation and copy to every output channel
+	frames := wav.Frames()
+	mono := make([]float64, frames)
+	for i := range mono {
+		sum := 0.0
+		for c := 0; c < int(wav.Channels); c++ {
+			pos := (i*int(wav.Channels) + c) * 2
+			sum += float64(int16(binary.LittleEndian.Uint16(wav.Data[pos : pos+2])))
+		}
+		mono[i] = sum / float64(wav.Channels)
+	}
+
+	outFrames := int(int64(frames) * int64(sampleRate) / int64(wav.SampleRate))
+	converted := &WAV{AudioFormat: 1, Channels: channels, SampleRate: sampleRate, BitsPerSample: 16}
+	converted.Data = make([]byte, outFrames*int(channels)*2)
+	for i := 0; i < outFrames; i++ {
+		pos := float64(i) * float64(wav.SampleRate) / float64(sampleRate)
+		j := int(pos)
+		sample := mono[j]
+		if j+1 < frames {
+			sample += (mono[j+1] - mono[j]) * (pos - float64(j))
+		}
+		for c := 0; c < int(channels); c++ {
+			binary.LittleEndian.PutUint16(converted.Data[(i*int(channels)+c)*2:], uint16(int16(math.Round(sample))))
+		}
+	}
+
+	return converted, nil
+}
+
+// ConcatWAV joins recordings that share a format into one, e.g. audio synthesised in chunks. The
+// sizes in the header are recalculated when the result is written with Bytes.
+func ConcatWAV(wavs []*WAV) (*WAV, error) {
+	if len(wavs) == 0 {
+		return nil, errors.New("There are no WAV files to join!")
+	}
+
+	first := wavs[0]
+	joined := &WAV{AudioFormat: first.AudioFormat, Channels: first.Channels, SampleRate: first.SampleRate, BitsPerSample: first.BitsPerSample}
+	size := 0
+	for _, wav := range wavs {
+		if wav.AudioFormat != first.AudioFormat || wav.Channels != first.Channels ||
+			wav.SampleRate != first.SampleRate || wav.BitsPerSample != first.BitsPerSample {
+			return nil, errors.New("WAV files with different formats can't be joined!")
+		}
+		size += len(wav.Data) - len(wav.Data)%wav.BlockAlign() // a partial frame would shift every later sample
+	}
+
+	joined.Data = make([]byte, 0, size)
+	for _, wav := range wavs {
+		joined.Data = append(joined.Data, wav.Data[:len(wav.Data)-len(wav.Data)%wav.BlockAlign()]...)
+	}
+	return joined, nil
+}
+
+// Samples decodes 16-bit PCM data into interleaved samples between -1 and 1.
+func (wav *WAV) Samples() []float64 {
+	samples := make([]float64, len(wav.Data)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(wav.Data[i*2:]))) / 32768
+	}
+	return samples
+}
+
+// SetSamples encodes interleaved samples between -1 and 1 as 16-bit PCM data, clipping any outside that range.
+func (wav *WAV) SetSamples(samples []float64) {
+	wav.Data = make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(wav.Data[i*2:], uint16(int16(math.Max(-32768, math.Min(32767, math.Round(sample*32768))))))
+	}
+}